@@ -0,0 +1,162 @@
+// Package bech32 implements the Bech32 encoding as specified in BIP 173,
+// without the 90 characters length limit, as used for X25519 keys.
+package bech32
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalid indicates a malformed Bech32 string.
+var ErrInvalid = errors.New("invalid bech32 string")
+
+const charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// checksumSize is the number of characters of the checksum.
+const checksumSize = 6
+
+var generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+// polymod computes the BCH checksum over the given 5-bit values.
+func polymod(values []byte) uint32 {
+	chk := uint32(1)
+
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+
+		for i := range generator {
+			if (top>>i)&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+
+	return chk
+}
+
+// hrpExpand expands the human-readable part for the checksum computation.
+func hrpExpand(hrp string) []byte {
+	expanded := make([]byte, 0, len(hrp)*2+1)
+
+	for i := range len(hrp) {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+
+	expanded = append(expanded, 0)
+
+	for i := range len(hrp) {
+		expanded = append(expanded, hrp[i]&31)
+	}
+
+	return expanded
+}
+
+// convertBits regroups data from frombits-bit to tobits-bit values.
+func convertBits(data []byte, frombits, tobits uint, pad bool) ([]byte, error) {
+	var (
+		acc  uint32
+		bits uint
+		out  []byte
+	)
+
+	maxv := uint32(1<<tobits) - 1
+
+	for _, value := range data {
+		if uint32(value)>>frombits != 0 {
+			return nil, fmt.Errorf("%w: invalid data range", ErrInvalid)
+		}
+
+		acc = acc<<frombits | uint32(value)
+		bits += frombits
+
+		for bits >= tobits {
+			bits -= tobits
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+
+	switch {
+	case pad && bits > 0:
+		out = append(out, byte(acc<<(tobits-bits)&maxv))
+	case !pad && bits >= frombits:
+		return nil, fmt.Errorf("%w: excess padding", ErrInvalid)
+	case !pad && acc<<(tobits-bits)&maxv != 0:
+		return nil, fmt.Errorf("%w: non-zero padding", ErrInvalid)
+	}
+
+	return out, nil
+}
+
+// Encode encodes the data with the human-readable part hrp, in lowercase.
+func Encode(hrp string, data []byte) (string, error) {
+	values, err := convertBits(data, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+
+	hrp = strings.ToLower(hrp)
+
+	checksum := polymod(append(append(hrpExpand(hrp), values...), make([]byte, checksumSize)...)) ^ 1
+
+	var builder strings.Builder
+
+	builder.WriteString(hrp)
+	builder.WriteByte('1')
+
+	for _, v := range values {
+		builder.WriteByte(charset[v])
+	}
+
+	for i := range checksumSize {
+		builder.WriteByte(charset[checksum>>(5*(checksumSize-1-i))&31])
+	}
+
+	return builder.String(), nil
+}
+
+// Decode decodes a Bech32 string in either all lowercase or all uppercase,
+// returning the human-readable part (in lowercase) and the data.
+func Decode(encoded string) (string, []byte, error) {
+	if strings.ToLower(encoded) != encoded && strings.ToUpper(encoded) != encoded {
+		return "", nil, fmt.Errorf("%w: mixed case", ErrInvalid)
+	}
+
+	encoded = strings.ToLower(encoded)
+
+	separator := strings.LastIndexByte(encoded, '1')
+	if separator < 1 || separator+checksumSize+1 > len(encoded) {
+		return "", nil, fmt.Errorf("%w: invalid separator position", ErrInvalid)
+	}
+
+	hrp := encoded[:separator]
+
+	for i := range len(hrp) {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, fmt.Errorf("%w: invalid character in human-readable part", ErrInvalid)
+		}
+	}
+
+	values := make([]byte, 0, len(encoded)-separator-1)
+
+	for i := separator + 1; i < len(encoded); i++ {
+		v := strings.IndexByte(charset, encoded[i])
+		if v < 0 {
+			return "", nil, fmt.Errorf("%w: invalid character %q", ErrInvalid, encoded[i])
+		}
+
+		values = append(values, byte(v))
+	}
+
+	if polymod(append(hrpExpand(hrp), values...)) != 1 {
+		return "", nil, fmt.Errorf("%w: invalid checksum", ErrInvalid)
+	}
+
+	data, err := convertBits(values[:len(values)-checksumSize], 5, 8, false)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return hrp, data, nil
+}
@@ -4,25 +4,123 @@ import (
 	"fmt"
 
 	"github.com/idelchi/gocry/internal/config"
+	"github.com/idelchi/gocry/internal/encrypt"
 	"github.com/idelchi/gogen/pkg/cobraext"
 )
 
 // setFileAndValidate reduces boilerplate code for commands that require
 // a file argument (as positional or piped) and a key argument.
+// Without a key argument, the passphrase is prompted for when running the command.
 func setFileAndValidate(cfg *config.Config, args []string) error {
 	arg, err := cobraext.PipeOrArg(args)
 	if err != nil {
 		return fmt.Errorf("reading password: %w", err)
 	}
 
+	if arg == "" {
+		return fmt.Errorf("%w: missing file, pass it as argument or on stdin", config.ErrUsage)
+	}
+
 	cfg.File = arg
 
+	return validate(cfg)
+}
+
+// validate validates the configuration, including the combinations of options the validation tags cannot express.
+// Commands processing the files under many paths call it directly, leaving File unset.
+func validate(cfg *config.Config) error {
 	if err := cobraext.Validate(cfg, cfg); err != nil {
 		return fmt.Errorf("validating configuration: %w", err)
 	}
 
-	if cfg.Key.String == "" && cfg.Key.File == "" {
-		return fmt.Errorf("%w: missing key: specify either --key or --key-file", config.ErrUsage)
+	if cfg.Key.KeyName != "" && cfg.Key.Keyring == "" {
+		return fmt.Errorf("%w: --key-name requires --keyring", config.ErrUsage)
+	}
+
+	if cfg.Type == encrypt.Deterministic && cfg.Cipher != encrypt.AES {
+		return fmt.Errorf("%w: deterministic encryption requires --cipher %s", config.ErrUsage, encrypt.AES)
+	}
+
+	// Passphrase-based keys use a random salt, which would defeat deterministic encryption
+	if cfg.Type == encrypt.Deterministic && !cfg.Key.HasKey() {
+		return fmt.Errorf("%w: deterministic encryption requires "+
+			"--key, --key-command, --key-fd, --key-file, --keyring or --key-provider", config.ErrUsage)
+	}
+
+	// Public-key wrapping uses a random ephemeral key, which would defeat deterministic encryption as well
+	if cfg.Type == encrypt.Deterministic && cfg.Operation == encrypt.Encrypt &&
+		(len(cfg.Key.Recipients) > 0 || len(cfg.Key.Identities) > 0) {
+		return fmt.Errorf("%w: deterministic encryption is not available with --recipient or --identity", config.ErrUsage)
+	}
+
+	switch {
+	case cfg.Armor && cfg.Format != encrypt.Age && cfg.Format != encrypt.OpenSSL:
+		return fmt.Errorf("%w: --armor requires --format %s or %s", config.ErrUsage, encrypt.Age, encrypt.OpenSSL)
+	case cfg.VaultID != "" && cfg.Format != encrypt.AnsibleVault:
+		return fmt.Errorf("%w: --vault-id requires --format %s", config.ErrUsage, encrypt.AnsibleVault)
+	case cfg.Format == encrypt.Age && cfg.Operation == encrypt.Encrypt:
+		return validateAge(cfg)
+	case cfg.Format == encrypt.AnsibleVault:
+		return validatePassword(cfg)
+	case cfg.Format == encrypt.OpenSSL && cfg.Operation == encrypt.Encrypt && cfg.Mode != encrypt.File:
+		return fmt.Errorf("%w: --format %s requires --mode %s", config.ErrUsage, encrypt.OpenSSL, encrypt.File)
+	case cfg.Format == encrypt.OpenSSL:
+		return validatePassword(cfg)
+	case cfg.Format == encrypt.Fernet && cfg.Operation == encrypt.Encrypt && cfg.Mode != encrypt.Line:
+		return fmt.Errorf("%w: --format %s requires --mode %s", config.ErrUsage, encrypt.Fernet, encrypt.Line)
+	case cfg.Format == encrypt.JWE || cfg.Format == encrypt.Fernet:
+		return validateRawKey(cfg)
+	}
+
+	return nil
+}
+
+// loadConfig reads the configuration without validating it, for commands that do not process a file.
+func loadConfig(cfg *config.Config) error {
+	if err := cobraext.Validate(cfg); err != nil {
+		return fmt.Errorf("loading configuration: %w", err)
+	}
+
+	return nil
+}
+
+// validateAge checks that the configuration can be expressed in the age format.
+func validateAge(cfg *config.Config) error {
+	switch {
+	case cfg.Mode != encrypt.File:
+		return fmt.Errorf("%w: --format %s requires --mode %s", config.ErrUsage, encrypt.Age, encrypt.File)
+	case cfg.Type == encrypt.Deterministic:
+		return fmt.Errorf("%w: deterministic encryption is not available with --format %s", config.ErrUsage, encrypt.Age)
+	case cfg.Key.HasKey():
+		return fmt.Errorf("%w: --format %s supports --recipient, --identity and --passphrase, "+
+			"not --key, --key-command, --key-fd, --key-file, --keyring or --key-provider", config.ErrUsage, encrypt.Age)
+	}
+
+	return nil
+}
+
+// validatePassword checks that the configuration can be expressed in formats keyed by a password only,
+// such as Ansible Vault and OpenSSL.
+func validatePassword(cfg *config.Config) error {
+	switch {
+	case cfg.Type == encrypt.Deterministic:
+		return fmt.Errorf("%w: deterministic encryption is not available with --format %s", config.ErrUsage, cfg.Format)
+	case cfg.Key.HasKey() || len(cfg.Key.Recipients) > 0 || len(cfg.Key.Identities) > 0:
+		return fmt.Errorf("%w: --format %s requires --passphrase or --vault-password-file", config.ErrUsage, cfg.Format)
+	}
+
+	return nil
+}
+
+// validateRawKey checks that the configuration can be expressed in formats keyed by a raw key only,
+// such as JWE and Fernet.
+func validateRawKey(cfg *config.Config) error {
+	switch {
+	case cfg.Type == encrypt.Deterministic:
+		return fmt.Errorf("%w: deterministic encryption is not available with --format %s", config.ErrUsage, cfg.Format)
+	case !cfg.Key.HasKey():
+		return fmt.Errorf("%w: --format %s requires --key, --key-command, --key-fd, --key-file, --keyring or --key-provider",
+			config.ErrUsage, cfg.Format)
 	}
 
 	return nil
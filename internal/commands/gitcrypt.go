@@ -0,0 +1,38 @@
+package commands
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/idelchi/gocry/internal/config"
+	"github.com/idelchi/gocry/internal/encrypt"
+	"github.com/idelchi/gocry/internal/logic"
+)
+
+// NewGitCryptImportCommand creates a new cobra command for migrating git-crypt encrypted files.
+func NewGitCryptImportCommand(cfg *config.Config) *cobra.Command {
+	var keyFile, attributes string
+
+	cmd := &cobra.Command{
+		Use:   "git-crypt-import [flags] file...",
+		Short: "Migrate git-crypt encrypted files",
+		Long: "Decrypt git-crypt encrypted files with a git-crypt key, and re-encrypt them in place in file mode\n" +
+			"with the specified key. The git-crypt filter entries in .gitattributes are rewritten to filter=" +
+			logic.GitCryptFilter + ".",
+		Args: cobra.MinimumNArgs(1),
+		PreRunE: func(_ *cobra.Command, _ []string) error {
+			cfg.Operation = encrypt.Encrypt
+
+			return validate(cfg)
+		},
+		RunE: func(_ *cobra.Command, args []string) error {
+			return logic.GitCryptImport(cfg, keyFile, attributes, args)
+		},
+	}
+
+	cmd.Flags().StringVar(&keyFile, "git-crypt-key", "", "Path to the git-crypt key, as exported by `git-crypt export-key`")
+	cmd.Flags().StringVar(&attributes, "attributes", ".gitattributes", "Path to the .gitattributes file to update, empty to skip")
+
+	_ = cmd.MarkFlagRequired("git-crypt-key")
+
+	return cmd
+}
@@ -0,0 +1,215 @@
+package commands
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/idelchi/gocry/internal/config"
+	"github.com/idelchi/gocry/internal/encrypt"
+	"github.com/idelchi/gocry/internal/logic"
+)
+
+// NewKeyCommand creates a new cobra command grouping the commands for managing symmetric keys.
+func NewKeyCommand(cfg *config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "key",
+		Short: "Generate and inspect symmetric keys",
+		Args:  cobra.NoArgs,
+	}
+
+	cmd.AddCommand(
+		newKeyGenerateCommand(),
+		newKeyFingerprintCommand(cfg),
+		newKeyCheckCommand(cfg),
+		newKeySplitCommand(cfg),
+		newKeyCombineCommand(),
+		newKeyExportCommand(cfg),
+		newKeyImportCommand(),
+		newKeyPassphraseCommand(cfg),
+	)
+
+	return cmd
+}
+
+// newKeyGenerateCommand creates a new cobra command for generating symmetric keys.
+func newKeyGenerateCommand() *cobra.Command {
+	var output, encoding string
+
+	cmd := &cobra.Command{
+		Use:   "generate",
+		Short: "Generate a random key",
+		Long: "Generate a random 32-byte key and print it to stdout, or write it to --output with permissions 0600.\n" +
+			"The fingerprint of the key is printed to stderr.",
+		Args: cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return logic.KeyGenerate(output, logic.KeyEncoding(encoding))
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Path to write the key to, which must not exist")
+	cmd.Flags().StringVar(&encoding, "encoding", string(logic.KeyHex), "Encoding of the key: hex, base64 (a Fernet key) or raw")
+
+	return cmd
+}
+
+// newKeyFingerprintCommand creates a new cobra command for printing the fingerprints of keys.
+func newKeyFingerprintCommand(cfg *config.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "fingerprint key-file...",
+		Short: "Print the fingerprint of keys",
+		Long:  "Print the fingerprint of each key file, as shown in wrong-key errors for ciphertext encrypted with it.",
+		Args:  cobra.MinimumNArgs(1),
+		PreRunE: func(_ *cobra.Command, _ []string) error {
+			return loadConfig(cfg)
+		},
+		RunE: func(_ *cobra.Command, args []string) error {
+			return logic.KeyFingerprint(args, cfg.Key.KeyPassphrase)
+		},
+	}
+}
+
+// newKeyCheckCommand creates a new cobra command for checking a key against encrypted files.
+func newKeyCheckCommand(cfg *config.Config) *cobra.Command {
+	var legacy bool
+
+	cmd := &cobra.Command{
+		Use:   "check [flags] key-file [path...]",
+		Short: "Check a key and the files it decrypts",
+		Long: "Check that the key file holds a valid key, as accepted by --key-file, and list which of the\n" +
+			"encrypted files under the given paths it decrypts. Directories are walked recursively.\n" +
+			"Legacy AES-CFB files cannot be recognized, and are only listed, as unverifiable, with --legacy.",
+		Args: cobra.MinimumNArgs(1),
+		PreRunE: func(_ *cobra.Command, _ []string) error {
+			cfg.Operation = encrypt.Decrypt
+
+			return validate(cfg)
+		},
+		RunE: func(_ *cobra.Command, args []string) error {
+			return logic.KeyCheck(cfg, args[0], legacy, args[1:])
+		},
+	}
+
+	cmd.Flags().BoolVar(&legacy, "legacy", false,
+		"List binary files in no recognized format as legacy AES-CFB ciphertext, as rekey --legacy takes them")
+
+	return cmd
+}
+
+// newKeySplitCommand creates a new cobra command for splitting a key into shares.
+func newKeySplitCommand(cfg *config.Config) *cobra.Command {
+	var (
+		threshold, shares int
+		output            string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "split [flags] key-file",
+		Short: "Split a key into shares",
+		Long: "Split the key into --shares shares with Shamir's secret sharing, any --threshold of which rebuild it.\n" +
+			"The shares are printed to stdout one per line, or written to <output>.1 to <output>.<shares>.\n" +
+			"Enough share files can be passed to --key-file in place of the key.",
+		Args: cobra.ExactArgs(1),
+		PreRunE: func(_ *cobra.Command, _ []string) error {
+			return loadConfig(cfg)
+		},
+		RunE: func(_ *cobra.Command, args []string) error {
+			return logic.KeySplit(args[0], cfg.Key.KeyPassphrase, threshold, shares, output)
+		},
+	}
+
+	cmd.Flags().IntVarP(&threshold, "threshold", "k", 2, "Number of shares needed to rebuild the key")
+	cmd.Flags().IntVarP(&shares, "shares", "n", 3, "Number of shares to split the key into")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Prefix of the share files to write, which must not exist")
+
+	return cmd
+}
+
+// newKeyCombineCommand creates a new cobra command for rebuilding a key from its shares.
+func newKeyCombineCommand() *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "combine [flags] share-file...",
+		Short: "Rebuild a key from its shares",
+		Long:  "Rebuild a key split with `key split` from enough of its shares, and print it in hex or write it to --output.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return logic.KeyCombine(args, output)
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Path to write the key to, which must not exist")
+
+	return cmd
+}
+
+// newKeyExportCommand creates a new cobra command for exporting a key as a mnemonic.
+func newKeyExportCommand(cfg *config.Config) *cobra.Command {
+	var qrCode bool
+
+	cmd := &cobra.Command{
+		Use:   "export [flags] key-file",
+		Short: "Export a key as a mnemonic",
+		Long: "Print the key as a 24-word BIP39 mnemonic, with a checksum catching mistyped words, for offline backup.\n" +
+			"With --qr, the mnemonic is also drawn as a QR code, dark modules as blocks, to print on paper.",
+		Args: cobra.ExactArgs(1),
+		PreRunE: func(_ *cobra.Command, _ []string) error {
+			return loadConfig(cfg)
+		},
+		RunE: func(_ *cobra.Command, args []string) error {
+			return logic.KeyExport(args[0], cfg.Key.KeyPassphrase, qrCode)
+		},
+	}
+
+	cmd.Flags().BoolVar(&qrCode, "qr", false, "Also draw the mnemonic as a QR code")
+
+	return cmd
+}
+
+// newKeyImportCommand creates a new cobra command for restoring a key from its mnemonic.
+func newKeyImportCommand() *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "import [flags] [word...]",
+		Short: "Restore a key from its mnemonic",
+		Long: "Restore a key exported with `key export` from its 24 words, given as arguments or on stdin,\n" +
+			"and print it in hex or write it to --output.",
+		RunE: func(_ *cobra.Command, args []string) error {
+			return logic.KeyImport(args, output)
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Path to write the key to, which must not exist")
+
+	return cmd
+}
+
+// newKeyPassphraseCommand creates a new cobra command for protecting a key file with a passphrase.
+func newKeyPassphraseCommand(cfg *config.Config) *cobra.Command {
+	var (
+		newPassphrase string
+		remove        bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "passphrase [flags] key-file",
+		Short: "Add, change or remove the passphrase of a key file",
+		Long: "Encrypt the key file in place with a key derived from a new passphrase with scrypt,\n" +
+			"replacing its current passphrase if it has one, or with --remove, store the key in hex again.\n" +
+			"The current passphrase is taken from --key-passphrase, and the passphrases are prompted for if not given.",
+		Args: cobra.ExactArgs(1),
+		PreRunE: func(_ *cobra.Command, _ []string) error {
+			return loadConfig(cfg)
+		},
+		RunE: func(_ *cobra.Command, args []string) error {
+			return logic.KeyPassphrase(args[0], cfg.Key.KeyPassphrase, newPassphrase, remove)
+		},
+	}
+
+	cmd.Flags().StringVar(&newPassphrase, "new-key-passphrase", "", "New passphrase to protect the key file with")
+	cmd.Flags().BoolVar(&remove, "remove", false, "Remove the passphrase, storing the key in hex")
+
+	cmd.MarkFlagsMutuallyExclusive("new-key-passphrase", "remove")
+
+	return cmd
+}
@@ -0,0 +1,27 @@
+package commands
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/idelchi/gocry/internal/logic"
+)
+
+// NewKeygenCommand creates a new cobra command for generating X25519 key pairs.
+func NewKeygenCommand() *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "keygen",
+		Short: "Generate an X25519 key pair",
+		Long: "Generate an X25519 identity (private key) and print it to stdout, or write it to --output.\n" +
+			"The matching recipient (public key) is printed to stderr, to pass to --recipient.",
+		Args: cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return logic.Keygen(output)
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Path to write the identity to, which must not exist")
+
+	return cmd
+}
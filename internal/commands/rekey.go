@@ -0,0 +1,52 @@
+package commands
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/idelchi/gocry/internal/config"
+	"github.com/idelchi/gocry/internal/encrypt"
+	"github.com/idelchi/gocry/internal/logic"
+)
+
+// NewRekeyCommand creates a new cobra command for rotating files to a new key.
+func NewRekeyCommand(cfg *config.Config) *cobra.Command {
+	var (
+		oldKeyFile, newKeyFile string
+		reencrypt, legacy      bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "rekey [flags] path...",
+		Short: "Rotate encrypted files to a new key",
+		Long: "Rotate the encrypted files under the given paths from the old key to the new key, in place.\n" +
+			"Directories are walked recursively. File-mode files get their data key rewrapped for the new key,\n" +
+			"leaving the payload untouched, while in other files only the encrypted lines are re-encrypted.\n" +
+			"JWE files and files from earlier versions are re-encrypted as a whole, as are legacy AES-CFB files\n" +
+			"with --legacy, which cannot be recognized, so only such files should be passed with it.\n" +
+			"Files in the age, Ansible Vault and OpenSSL formats cannot be rotated with keys, and are reported as an error.\n" +
+			"A summary is printed to stderr.",
+		Args: cobra.MinimumNArgs(1),
+		PreRunE: func(_ *cobra.Command, _ []string) error {
+			cfg.Operation = encrypt.Encrypt
+
+			return validate(cfg)
+		},
+		RunE: func(_ *cobra.Command, args []string) error {
+			return logic.Rekey(cfg, oldKeyFile, newKeyFile, reencrypt, legacy, args)
+		},
+	}
+
+	cmd.Flags().StringVar(&oldKeyFile, "old-key-file", "", "Path to the key file the files are currently encrypted with")
+	cmd.Flags().StringVar(&newKeyFile, "new-key-file", "", "Path to the key file to re-encrypt the files with")
+
+	cmd.Flags().BoolVar(&reencrypt, "reencrypt", false,
+		"Re-encrypt file-mode files as a whole instead of rewrapping, as needed if the old key is compromised")
+
+	cmd.Flags().BoolVar(&legacy, "legacy", false,
+		"Re-encrypt binary files in no recognized format as legacy AES-CFB ciphertext; pass only such files")
+
+	_ = cmd.MarkFlagRequired("old-key-file")
+	_ = cmd.MarkFlagRequired("new-key-file")
+
+	return cmd
+}
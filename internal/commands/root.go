@@ -6,6 +6,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/idelchi/gocry/internal/config"
+	"github.com/idelchi/gocry/internal/encrypt"
 	"github.com/idelchi/gogen/pkg/cobraext"
 )
 
@@ -20,13 +21,35 @@ func NewRootCommand(cfg *config.Config, version string) *cobra.Command {
 
 	root.Flags().BoolP("show", "s", false, "Show the configuration and exit")
 	root.Flags().IntP("parallel", "j", runtime.NumCPU(), "Number of parallel workers")
-	root.Flags().StringP("key", "k", "", "Encryption key")
-	root.Flags().StringP("key-file", "f", "", "Path to the key file with the encryption key")
+	root.Flags().StringP("key", "k", "", "Encryption key, in hex or as a Fernet key")
+	root.Flags().String("key-command", "", "Shell command printing the encryption key")
+	root.Flags().Int("key-fd", 0, "Inherited file descriptor to read the encryption key from")
+	root.Flags().StringArrayP("key-file", "f", nil, "Path to a key file with an encryption key, repeat to encrypt for several recipients")
+	root.Flags().String("keyring", "", "Path to a keyring file of named, versioned keys")
+	root.Flags().String("key-name", "", "Name of the keyring key to encrypt with (default: the only one)")
+	root.Flags().String("key-provider", "", "Key provider plugin gocry-key-<name> to get keys from, as name:argument")
+	root.Flags().String("key-passphrase", "", "Passphrase of key files protected with one (default: prompted for)")
+	root.Flags().StringArrayP("recipient", "r", nil, "X25519 public key to encrypt for, repeatable")
+	root.Flags().StringArrayP("identity", "i", nil, "Path to a file with X25519 private keys to decrypt with, repeatable")
+	root.Flags().StringP("passphrase", "p", "", "Passphrase to derive the encryption key from")
+	root.Flags().String("vault-password-file", "", "Path to the Ansible Vault password file, or an executable printing the password")
+	root.Flags().String("kdf", "argon2id", "Key derivation function for passphrases: argon2id or scrypt")
+	root.Flags().String("context", "", "Context to derive the per-file key with (default: the file path)")
 	root.Flags().StringP("mode", "m", "file", "Mode of operation: file or line")
+	root.Flags().StringP("type", "t", "random", "Type of encryption: random or deterministic")
+	root.Flags().StringP("cipher", "c", string(encrypt.AES), "Cipher: aes-256-gcm or xchacha20-poly1305")
+	root.Flags().String("format", string(encrypt.GoCry), "Format to encrypt to: gocry, age, ansible-vault, openssl, jwe or fernet")
+	root.Flags().BoolP("armor", "a", false, "Encode age or openssl output as text")
+	root.Flags().Int("iter", encrypt.DefaultIterations, "PBKDF2 iteration count for the openssl format")
+	root.Flags().String("jwe-alg", string(encrypt.JWEDirect), "Key management algorithm for the jwe format: dir or A256KW")
+	root.Flags().Duration("ttl", 0, "Maximum age of Fernet tokens to decrypt, unlimited if zero")
+	root.Flags().String("md", string(encrypt.SHA256), "PBKDF2 digest for the openssl format: sha1, sha256 or sha512")
+	root.Flags().String("vault-id", "", "Vault ID label for ansible-vault output")
 	root.Flags().StringP("encrypt", "e", "### DIRECTIVE: ENCRYPT", "Directives for encryption")
 	root.Flags().StringP("decrypt", "d", "### DIRECTIVE: DECRYPT", "Directives for decryption")
 
-	root.AddCommand(NewEncryptCommand(cfg), NewDecryptCommand(cfg))
+	root.AddCommand(NewEncryptCommand(cfg), NewDecryptCommand(cfg), NewKeygenCommand(), NewGitCryptImportCommand(cfg),
+		NewRekeyCommand(cfg), NewKeyCommand(cfg))
 
 	return root
 }
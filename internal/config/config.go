@@ -3,6 +3,7 @@ package config
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/idelchi/gocry/internal/encrypt"
 	"github.com/idelchi/gogen/pkg/validator"
@@ -11,13 +12,55 @@ import (
 // ErrUsage indicates an error in command-line usage or configuration.
 var ErrUsage = errors.New("usage error")
 
+// MinPassphraseLength is the minimum length of a passphrase, matching the validation of Key.Passphrase.
+const MinPassphraseLength = 8
+
 // Key represents an encryption key configuration.
 type Key struct {
-	// String is a hexadecimal key string
-	String string `label:"--key" mapstructure:"key" mask:"fixed" validate:"omitempty,exclusive=File,hexadecimal,len=64"`
+	// String is a hexadecimal or Fernet key string
+	String string `label:"--key" mapstructure:"key" mask:"fixed" validate:"omitempty,exclusive=File Command FD Passphrase,key"`
+
+	// Command is a shell command printing the key
+	Command string `label:"--key-command" mapstructure:"key-command" validate:"exclusive=String FD File Passphrase"`
+
+	// FD is an inherited file descriptor to read the key from, unset if zero
+	FD int `label:"--key-fd" mapstructure:"key-fd" validate:"omitempty,min=3,exclusive=String Command File Passphrase"`
+
+	// File holds paths to files containing a hexadecimal or Fernet key string, one per recipient
+	File []string `label:"--key-file" mapstructure:"key-file" validate:"exclusive=String Command FD Passphrase"`
+
+	// Keyring is a path to a keyring file of named, versioned keys
+	Keyring string `label:"--keyring" mapstructure:"keyring" validate:"exclusive=Passphrase"`
+
+	// KeyName selects the key of the keyring to encrypt with
+	KeyName string `label:"--key-name" mapstructure:"key-name"`
+
+	// Provider is a key provider plugin to get keys from, as name:argument
+	Provider string `label:"--key-provider" mapstructure:"key-provider" validate:"exclusive=Passphrase"`
+
+	// Recipients holds X25519 public keys to encrypt for
+	Recipients []string `label:"--recipient" mapstructure:"recipient" validate:"exclusive=Passphrase"`
+
+	// Identities holds paths to files containing X25519 private keys to decrypt with
+	Identities []string `label:"--identity" mapstructure:"identity" validate:"exclusive=Passphrase"`
+
+	// Passphrase is a passphrase to derive the key from
+	Passphrase string `label:"--passphrase" mapstructure:"passphrase" mask:"fixed" validate:"omitempty,exclusive=String Command FD File Keyring Provider Recipients Identities VaultPasswordFile,min=8"`
+
+	// VaultPasswordFile is a path to a file with the Ansible Vault password, or an executable printing it
+	VaultPasswordFile string `label:"--vault-password-file" mapstructure:"vault-password-file" validate:"exclusive=String Command FD File Keyring Provider Recipients Identities Passphrase"`
+
+	// KDF is the key derivation function for passphrases
+	KDF string `label:"--kdf" mapstructure:"kdf" validate:"oneof=argon2id scrypt"`
+
+	// KeyPassphrase is the passphrase of key files protected with one, prompted for if empty
+	KeyPassphrase string `label:"--key-passphrase" mapstructure:"key-passphrase" mask:"fixed"`
+}
 
-	// File is a path to a file containing a hexadecimal key string
-	File string `label:"--key-file" mapstructure:"key-file" validate:"exclusive=String"`
+// HasKey reports whether any symmetric key is configured, as a key string, key command or descriptor,
+// key files, a keyring or a key provider.
+func (k Key) HasKey() bool {
+	return k.String != "" || k.Command != "" || k.FD != 0 || len(k.File) > 0 || k.Keyring != "" || k.Provider != ""
 }
 
 // Config holds the application's configuration parameters.
@@ -31,14 +74,44 @@ type Config struct {
 	// Mode is the encryption mode
 	Mode encrypt.Mode `validate:"oneof=file line"`
 
+	// Format is the ciphertext format to encrypt to
+	Format encrypt.Format `validate:"oneof=gocry age ansible-vault openssl jwe fernet"`
+
+	// Armor encodes age and OpenSSL output as text
+	Armor bool `mapstructure:"armor"`
+
+	// Iterations is the PBKDF2 iteration count for the OpenSSL format
+	Iterations int `mapstructure:"iter" validate:"min=1"`
+
+	// Digest is the PBKDF2 digest for the OpenSSL format
+	Digest encrypt.Digest `mapstructure:"md" validate:"oneof=sha1 sha256 sha512"`
+
+	// JWEAlgorithm is the key management algorithm for the JWE format
+	JWEAlgorithm encrypt.JWEAlgorithm `mapstructure:"jwe-alg" validate:"oneof=dir A256KW"`
+
+	// TTL is the maximum age of Fernet tokens on decryption, unlimited if zero
+	TTL time.Duration `mapstructure:"ttl" validate:"min=0"`
+
+	// VaultID labels Ansible Vault output
+	VaultID string `mapstructure:"vault-id"`
+
+	// Type is the encryption type
+	Type encrypt.Type `validate:"oneof=random deterministic"`
+
+	// Cipher is the cipher to encrypt with
+	Cipher encrypt.Cipher `validate:"oneof=aes-256-gcm xchacha20-poly1305"`
+
 	// Operation is the encryption operation
 	Operation encrypt.Operation `mapstructure:"-" validate:"oneof=encrypt decrypt"`
 
 	// Key is the encryption key
 	Key Key `mapstructure:",squash"`
 
-	// File is the path to the input file
-	File string `mapstructure:"-" validate:"required"`
+	// File is the path to the input file, unset for commands processing the files under many paths
+	File string `mapstructure:"-"`
+
+	// Context is bound into the per-file key, defaulting to File
+	Context string `mapstructure:"context"`
 
 	// Directives contains the markers used to identify content for processing
 	Directives encrypt.Directives `mapstructure:",squash"`
@@ -58,6 +131,10 @@ func (c Config) Validate(config any) error {
 		return fmt.Errorf("registering exclusive: %w", err)
 	}
 
+	if err := registerKey(validator); err != nil {
+		return fmt.Errorf("registering key: %w", err)
+	}
+
 	errs := validator.Validate(config)
 
 	switch {
@@ -0,0 +1,64 @@
+package config_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/idelchi/gocry/internal/config"
+	"github.com/idelchi/gocry/internal/encrypt"
+)
+
+const testKey = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+// TestValidateKeySources checks which key sources can be combined.
+func TestValidateKeySources(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		key   config.Key
+		valid bool
+	}{
+		{name: "key", key: config.Key{String: testKey}, valid: true},
+		{name: "key files", key: config.Key{File: []string{"alice.key", "bob.key"}}, valid: true},
+		{name: "key command", key: config.Key{Command: "pass show gocry"}, valid: true},
+		{name: "key fd", key: config.Key{FD: 3}, valid: true},
+		{name: "key command and key file", key: config.Key{Command: "pass show gocry", File: []string{"bob.key"}}},
+		{name: "key fd and key file", key: config.Key{FD: 3, File: []string{"bob.key"}}},
+		{name: "key command and key fd", key: config.Key{Command: "pass show gocry", FD: 3}},
+		{name: "key and key file", key: config.Key{String: testKey, File: []string{"bob.key"}}},
+		{name: "key and key command", key: config.Key{String: testKey, Command: "pass show gocry"}},
+		{name: "key file and passphrase", key: config.Key{File: []string{"alice.key"}, Passphrase: "correct horse"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			test.key.KDF = "argon2id"
+
+			cfg := config.Config{
+				Parallel:     1,
+				Mode:         encrypt.File,
+				Format:       encrypt.GoCry,
+				Iterations:   1,
+				Digest:       encrypt.SHA256,
+				JWEAlgorithm: encrypt.JWEDirect,
+				Type:         encrypt.Random,
+				Cipher:       encrypt.AES,
+				Operation:    encrypt.Encrypt,
+				Key:          test.key,
+				File:         "secrets.txt",
+			}
+
+			err := cfg.Validate(cfg)
+
+			switch {
+			case test.valid && err != nil:
+				t.Fatalf("Validate: %v", err)
+			case !test.valid && !errors.Is(err, config.ErrUsage):
+				t.Fatalf("Validate error = %v, want %v", err, config.ErrUsage)
+			}
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"reflect"
 	"strings"
@@ -38,23 +40,69 @@ func registerExclusive(validator *validator.Validator) error {
 	return nil
 }
 
-// validateExclusive checks if two fields are mutually exclusive.
-// Returns false if both fields have non-empty values.
+// validateExclusive checks if a field is mutually exclusive with the fields
+// given as a space-separated list in the parameter.
+// Returns false if the field and any of the other fields have non-empty values.
 func validateExclusive(fl validator.FieldLevel) bool {
-	otherFieldName := fl.Param()
-	field := fl.Field()
-	otherField := fl.Parent().FieldByName(otherFieldName)
-
-	if !field.IsValid() || !otherField.IsValid() {
+	if !isSet(fl.Field()) {
 		return true
 	}
 
-	if field.Kind() == reflect.String && otherField.Kind() == reflect.String {
-		currentValue := field.String()
-		otherValue := otherField.String()
-
-		return !(currentValue != "" && otherValue != "")
+	for _, otherFieldName := range strings.Fields(fl.Param()) {
+		if isSet(fl.Parent().FieldByName(otherFieldName)) {
+			return false
+		}
 	}
 
 	return true
 }
+
+// isSet reports whether the field is a non-empty string or slice, or a non-zero integer.
+func isSet(field reflect.Value) bool {
+	if !field.IsValid() {
+		return false
+	}
+
+	switch field.Kind() {
+	case reflect.String, reflect.Slice:
+		return field.Len() > 0
+	case reflect.Int:
+		return field.Int() != 0
+	default:
+		return false
+	}
+}
+
+// registerKey adds a custom validator for the format of keys, along with its error message.
+func registerKey(validator *validator.Validator) error {
+	if err := validator.RegisterValidationAndTranslation(
+		"key",
+		validateKey,
+		"{0} must be a 64-character hex key or a 44-character base64 Fernet key",
+	); err != nil {
+		return fmt.Errorf("registering key validation: %w", err)
+	}
+
+	return nil
+}
+
+// validateKey checks that the field holds a 32-byte key, either in hex or as a standard or url-safe base64 Fernet key.
+func validateKey(fl validator.FieldLevel) bool {
+	const keySize = 32
+
+	encoded := fl.Field().String()
+
+	if len(encoded) == hex.EncodedLen(keySize) {
+		_, err := hex.DecodeString(encoded)
+
+		return err == nil
+	}
+
+	for _, encoding := range []*base64.Encoding{base64.URLEncoding, base64.StdEncoding} {
+		if key, err := encoding.DecodeString(encoded); err == nil && len(key) == keySize {
+			return true
+		}
+	}
+
+	return false
+}
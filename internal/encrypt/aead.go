@@ -0,0 +1,76 @@
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	// aesKeySize is the key size for AES-256.
+	aesKeySize = 32
+
+	// sivKeySize is the key size for AES-256-SIV, which uses two AES-256 keys.
+	sivKeySize = 2 * aesKeySize
+)
+
+// newAEAD creates the AEAD for the suite announced in header, keyed with a subkey of key.
+func newAEAD(header *Header, key []byte, info string) (cipher.AEAD, error) {
+	switch header.Suite {
+	case AES256GCM:
+		subkey, err := deriveKey(key, info, aesKeySize)
+		if err != nil {
+			return nil, err
+		}
+
+		return newGCM(subkey)
+	case AES256SIV:
+		subkey, err := deriveKey(key, info, sivKeySize)
+		if err != nil {
+			return nil, err
+		}
+
+		return newSIV(subkey)
+	case XChaCha20Poly1305:
+		subkey, err := deriveKey(key, info, chacha20poly1305.KeySize)
+		if err != nil {
+			return nil, err
+		}
+
+		aead, err := chacha20poly1305.NewX(subkey)
+		if err != nil {
+			return nil, fmt.Errorf("creating XChaCha20-Poly1305: %w", err)
+		}
+
+		return aead, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported cipher suite %s", ErrHeader, header.Suite)
+	}
+}
+
+// newGCM creates an AES-GCM AEAD for the given key.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("creating GCM: %w", err)
+	}
+
+	return aead, nil
+}
+
+// wrapAEAD creates the AES-SIV AEAD used to wrap data keys, keyed with a subkey of key.
+func wrapAEAD(key []byte) (cipher.AEAD, error) {
+	subkey, err := deriveKey(key, infoWrap, sivKeySize)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSIV(subkey)
+}
@@ -0,0 +1,153 @@
+package encrypt
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// ageIntro is the first line of binary age files.
+const ageIntro = "age-encryption.org/v1\n"
+
+// isAge reports whether the reader starts with an age file, either binary or armored,
+// without consuming any input.
+func isAge(reader *bufio.Reader) bool {
+	return hasPrefix(reader, ageIntro) || hasPrefix(reader, armor.Header)
+}
+
+// hasPrefix reports whether the reader starts with prefix, without consuming any input.
+func hasPrefix(reader *bufio.Reader, prefix string) bool {
+	peeked, err := reader.Peek(len(prefix))
+
+	return err == nil && bytes.Equal(peeked, []byte(prefix))
+}
+
+// encryptAge encrypts data from reader to writer in the age v1 format (https://age-encryption.org/v1),
+// armored if requested.
+// X25519 recipients and passphrases are supported; passphrases always use scrypt, as required by age.
+func (e *Encryptor) encryptAge(reader io.Reader, writer io.Writer) error {
+	recipients := make([]age.Recipient, 0, len(e.Recipients))
+
+	for _, recipient := range e.Recipients {
+		var (
+			converted age.Recipient
+			err       error
+		)
+
+		switch recipient := recipient.(type) {
+		case *X25519Recipient:
+			converted, err = age.ParseX25519Recipient(recipient.String())
+		case *Passphrase:
+			converted, err = age.NewScryptRecipient(string(recipient.passphrase))
+		default:
+			return fmt.Errorf("%w: the age format only supports X25519 recipients and passphrases, not %s",
+				ErrProcessing, describe(recipient))
+		}
+
+		if err != nil {
+			return fmt.Errorf("%w: converting recipient: %w", ErrProcessing, err)
+		}
+
+		recipients = append(recipients, converted)
+	}
+
+	output := writer
+
+	var armored io.WriteCloser
+
+	if e.Armor {
+		armored = armor.NewWriter(writer)
+		output = armored
+	}
+
+	encrypted, err := age.Encrypt(output, recipients...)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrProcessing, err)
+	}
+
+	if _, err := io.Copy(encrypted, reader); err != nil {
+		return fmt.Errorf("encrypting data: %w", err)
+	}
+
+	if err := encrypted.Close(); err != nil {
+		return fmt.Errorf("finishing encryption: %w", err)
+	}
+
+	if armored != nil {
+		if err := armored.Close(); err != nil {
+			return fmt.Errorf("finishing armor: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// decryptAge decrypts an age file, binary or armored, from reader to writer,
+// with the X25519 identities and passphrase.
+// As with the native format, output is written as soon as it is authenticated;
+// on error, the output written so far must be discarded.
+func (e *Encryptor) decryptAge(reader *bufio.Reader, writer io.Writer) error {
+	identities := make([]age.Identity, 0, len(e.Identities))
+
+	for _, identity := range e.Identities {
+		var (
+			converted age.Identity
+			err       error
+		)
+
+		switch identity := identity.(type) {
+		case *X25519Identity:
+			converted, err = age.ParseX25519Identity(identity.Encode())
+		case *Passphrase:
+			converted, err = age.NewScryptIdentity(string(identity.passphrase))
+		default:
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("%w: converting identity: %w", ErrProcessing, err)
+		}
+
+		identities = append(identities, converted)
+	}
+
+	if len(identities) == 0 {
+		return fmt.Errorf("%w: age files require an X25519 identity or a passphrase", ErrWrongKey)
+	}
+
+	var input io.Reader = reader
+	if hasPrefix(reader, armor.Header) {
+		input = armor.NewReader(reader)
+	}
+
+	decrypted, err := age.Decrypt(input, identities...)
+
+	var noMatch *age.NoIdentityMatchError
+
+	switch {
+	case errors.As(err, &noMatch):
+		return fmt.Errorf("%w: none of the supplied identities match the age file", ErrWrongKey)
+	case err != nil:
+		return fmt.Errorf("%w: %w", ErrProcessing, err)
+	}
+
+	if _, err := io.Copy(writer, decrypted); err != nil {
+		return fmt.Errorf("%w: %w", ErrAuthentication, err)
+	}
+
+	return nil
+}
+
+// describe describes a recipient in error messages.
+func describe(recipient Recipient) string {
+	if stringer, ok := recipient.(fmt.Stringer); ok {
+		return stringer.String()
+	}
+
+	return fmt.Sprintf("%T", recipient)
+}
@@ -0,0 +1,171 @@
+package encrypt
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// processData runs the encryptor over the input as a whole file and returns its output.
+func processData(e *Encryptor, input []byte) ([]byte, error) {
+	var output bytes.Buffer
+
+	if e.Mode == "" {
+		e.Mode = File
+	}
+
+	_, err := e.Process(bytes.NewReader(input), &output)
+
+	return output.Bytes(), err
+}
+
+// TestAgeInterop encrypts files for age to decrypt, and decrypts files age encrypted,
+// with X25519 keys and passphrases, binary and armored.
+func TestAgeInterop(t *testing.T) {
+	t.Parallel()
+
+	identity, err := GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("GenerateX25519Identity: %v", err)
+	}
+
+	ageIdentity, err := age.ParseX25519Identity(identity.Encode())
+	if err != nil {
+		t.Fatalf("parsing identity with age: %v", err)
+	}
+
+	const passphrase = "correct horse battery staple"
+
+	ageScrypt, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		t.Fatalf("NewScryptRecipient: %v", err)
+	}
+
+	// The minimum work factor keeps encryption by age fast; gocry accepts any age allows.
+	ageScrypt.SetWorkFactor(10)
+
+	ageScryptIdentity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		t.Fatalf("NewScryptIdentity: %v", err)
+	}
+
+	secret := NewPassphrase([]byte(passphrase), KDFScrypt)
+	plaintext := bytes.Repeat([]byte("password: hunter2\n"), 5000)
+
+	tests := []struct {
+		name         string
+		recipient    Recipient
+		identity     Identity
+		ageRecipient age.Recipient
+		ageIdentity  age.Identity
+		armor        bool
+	}{
+		{
+			name:         "x25519",
+			recipient:    identity.Recipient(),
+			identity:     identity,
+			ageRecipient: ageIdentity.Recipient(),
+			ageIdentity:  ageIdentity,
+		},
+		{
+			name:         "x25519 armored",
+			recipient:    identity.Recipient(),
+			identity:     identity,
+			ageRecipient: ageIdentity.Recipient(),
+			ageIdentity:  ageIdentity,
+			armor:        true,
+		},
+		{
+			name:         "scrypt",
+			recipient:    secret,
+			identity:     secret,
+			ageRecipient: ageScrypt,
+			ageIdentity:  ageScryptIdentity,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name+" to age", func(t *testing.T) {
+			t.Parallel()
+
+			encrypted, err := processData(&Encryptor{
+				Operation:  Encrypt,
+				Format:     Age,
+				Armor:      test.armor,
+				Recipients: []Recipient{test.recipient},
+			}, plaintext)
+			if err != nil {
+				t.Fatalf("encrypting: %v", err)
+			}
+
+			if test.armor != bytes.HasPrefix(encrypted, []byte(armor.Header)) {
+				t.Fatalf("encrypted file starts with %q, armored: %t", encrypted[:min(len(encrypted), 40)], test.armor)
+			}
+
+			var input io.Reader = bytes.NewReader(encrypted)
+			if test.armor {
+				input = armor.NewReader(input)
+			}
+
+			decrypted, err := age.Decrypt(input, test.ageIdentity)
+			if err != nil {
+				t.Fatalf("decrypting with age: %v", err)
+			}
+
+			if data, err := io.ReadAll(decrypted); err != nil || !bytes.Equal(data, plaintext) {
+				t.Fatalf("age decrypted %d bytes (%v), want the %d bytes of plaintext", len(data), err, len(plaintext))
+			}
+		})
+
+		t.Run(test.name+" from age", func(t *testing.T) {
+			t.Parallel()
+
+			var encrypted bytes.Buffer
+
+			output := io.WriteCloser(nopCloser{&encrypted})
+			if test.armor {
+				output = armor.NewWriter(&encrypted)
+			}
+
+			writer, err := age.Encrypt(output, test.ageRecipient)
+			if err != nil {
+				t.Fatalf("encrypting with age: %v", err)
+			}
+
+			if _, err := writer.Write(plaintext); err != nil {
+				t.Fatalf("encrypting with age: %v", err)
+			}
+
+			if err := writer.Close(); err != nil {
+				t.Fatalf("finishing encryption with age: %v", err)
+			}
+
+			if err := output.Close(); err != nil {
+				t.Fatalf("finishing armor: %v", err)
+			}
+
+			decrypted, err := processData(&Encryptor{Operation: Decrypt, Identities: []Identity{test.identity}},
+				encrypted.Bytes())
+
+			switch {
+			case err != nil:
+				t.Fatalf("decrypting: %v", err)
+			case !bytes.Equal(decrypted, plaintext):
+				t.Fatalf("decrypted %d bytes, want the %d bytes of plaintext", len(decrypted), len(plaintext))
+			}
+		})
+	}
+}
+
+// nopCloser adds a Close method doing nothing to a writer.
+type nopCloser struct {
+	io.Writer
+}
+
+// Close does nothing.
+func (nopCloser) Close() error {
+	return nil
+}
@@ -1,59 +1,81 @@
 package encrypt
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
+	"bytes"
 	"crypto/rand"
 	"fmt"
 	"io"
 )
 
-// encryptBytes encrypts the given byte slice using AES-CFB mode.
-// It prepends a random IV to the ciphertext and returns the complete encrypted block.
-// The returned format is: [16 bytes IV][variable-length ciphertext].
+// encryptBytes encrypts the given byte slice with the cipher suite announced in the header.
+// The returned format is: [header][nonce][ciphertext][tag].
+// The header is authenticated as additional data.
 func (e *Encryptor) encryptBytes(data []byte) ([]byte, error) {
-	block, err := aes.NewCipher(e.Key)
+	header, key, err := e.newHeader()
 	if err != nil {
-		return nil, fmt.Errorf("creating cipher: %w", err)
+		return nil, err
 	}
 
-	// Allocate space for IV and ciphertext in a single slice
-	ciphertext := make([]byte, aes.BlockSize+len(data))
-	initializationVector := ciphertext[:aes.BlockSize]
+	return sealBytes(header, key, data)
+}
+
+// sealBytes encrypts data under the header with the key bound to its context, as described in encryptBytes.
+func sealBytes(header *Header, key, data []byte) ([]byte, error) {
+	raw, err := header.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(header, key, infoLine)
+	if err != nil {
+		return nil, err
+	}
 
-	// Generate random IV using crypto/rand
-	if _, err := io.ReadFull(rand.Reader, initializationVector); err != nil {
-		return nil, fmt.Errorf("generating IV: %w", err)
+	// Generate random nonce using crypto/rand (empty for deterministic suites)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("generating nonce: %w", err)
 	}
 
-	// Encrypt data using CFB mode
-	stream := cipher.NewCFBEncrypter(block, initializationVector)
-	stream.XORKeyStream(ciphertext[aes.BlockSize:], data)
+	ciphertext := append(raw, nonce...)
 
-	return ciphertext, nil
+	return aead.Seal(ciphertext, nonce, data, raw), nil
 }
 
-// decryptBytes decrypts the given ciphertext using AES-CFB mode.
-// It expects the input to be in the format: [16 bytes IV][variable-length ciphertext].
+// decryptBytes decrypts the given ciphertext as produced by encryptBytes.
+// Ciphertext without a header is handed to the legacy AES-CFB decryption.
 // Returns the original plaintext on success.
 func (e *Encryptor) decryptBytes(ciphertext []byte) ([]byte, error) {
-	// Verify minimum length requirement for IV
-	if len(ciphertext) < aes.BlockSize {
-		return nil, fmt.Errorf("%w: ciphertext too short", ErrProcessing)
+	if !bytes.HasPrefix(ciphertext, magic) {
+		return e.decryptBytesCFB(ciphertext)
 	}
 
-	block, err := aes.NewCipher(e.Key)
+	header, raw, err := readHeader(bytes.NewReader(ciphertext))
 	if err != nil {
-		return nil, fmt.Errorf("creating cipher: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrProcessing, err)
 	}
 
-	// Extract IV and actual ciphertext
-	iv := ciphertext[:aes.BlockSize]
-	ciphertext = ciphertext[aes.BlockSize:]
+	key, err := e.keyFor(header)
+	if err != nil {
+		return nil, err
+	}
 
-	// Decrypt data using CFB mode
-	stream := cipher.NewCFBDecrypter(block, iv)
-	stream.XORKeyStream(ciphertext, ciphertext) // Decryption happens in-place
+	aead, err := newAEAD(header, key, infoLine)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrProcessing, err)
+	}
+
+	ciphertext = ciphertext[len(raw):]
+
+	// Verify minimum length requirement for nonce and tag
+	if len(ciphertext) < aead.NonceSize()+aead.Overhead() {
+		return nil, fmt.Errorf("%w: ciphertext too short", ErrProcessing)
+	}
+
+	plaintext, err := aead.Open(nil, ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():], raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: wrong key or tampered ciphertext", ErrAuthentication)
+	}
 
-	return ciphertext, nil
+	return plaintext, nil
 }
@@ -17,6 +17,59 @@ const (
 // Type represents whether encryption is deterministic or not.
 type Type string
 
+const (
+	// Random encryption uses a fresh random nonce each time, so encrypting
+	// the same plaintext twice yields different ciphertexts.
+	Random Type = "random"
+
+	// Deterministic encryption uses AES-SIV, so the same plaintext under the same key
+	// always yields byte-identical ciphertext. It reveals whether two plaintexts are equal,
+	// but avoids spurious changes when re-encrypting unchanged content, e.g. in git filters.
+	Deterministic Type = "deterministic"
+)
+
+// Cipher represents the cipher used for encryption.
+type Cipher string
+
+const (
+	// AES uses AES-256-GCM, or AES-256-SIV for deterministic encryption.
+	AES Cipher = "aes-256-gcm"
+
+	// XChaCha20 uses XChaCha20-Poly1305 with 24 bytes random nonces.
+	// It is fast on hosts without hardware AES support, and its nonces are large enough
+	// to be generated randomly without concern for collisions.
+	XChaCha20 Cipher = "xchacha20-poly1305"
+)
+
+// Format represents the ciphertext format written when encrypting.
+// Decryption detects the format from the input.
+type Format string
+
+const (
+	// GoCry writes the native gocry format, in both file and line mode.
+	GoCry Format = "gocry"
+
+	// Age writes the age v1 format (https://age-encryption.org/v1), in file mode only,
+	// so that the output can be decrypted with age and vice versa.
+	Age Format = "age"
+
+	// AnsibleVault writes the Ansible Vault 1.1 format (1.2 with a vault ID), with a password.
+	// In file mode, the whole file is encrypted as with `ansible-vault encrypt`.
+	// In line mode, values are encrypted into inline `!vault` YAML scalars as with `ansible-vault encrypt_string`.
+	AnsibleVault Format = "ansible-vault"
+
+	// OpenSSL writes the format of `openssl enc -aes-256-cbc -pbkdf2 -salt`, in file mode only, with a password.
+	// The PBKDF2 iteration count and digest are not recorded, and must match on decryption.
+	OpenSSL Format = "openssl"
+
+	// JWE writes RFC 7516 compact JWE with A256GCM, using the key directly or to wrap the content key.
+	// In file mode, the whole file is a single JWE. In line mode, each encrypted line is a JWE.
+	JWE Format = "jwe"
+
+	// Fernet writes each encrypted line as a Fernet token, using the key as a Fernet key. Available in line mode only.
+	Fernet Format = "fernet"
+)
+
 // Mode represents the mode of operation for processing input data.
 // It determines how the input data is handled during encryption/decryption.
 type Mode string
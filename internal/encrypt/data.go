@@ -8,7 +8,20 @@ import (
 // encryptData encrypts the given data and encodes it in base64.
 // This is used for line-mode encryption where the output needs to be
 // safely represented as a string in the output file.
+// With the JWE and Fernet formats, the output is a compact JWE or a Fernet token instead.
 func (e *Encryptor) encryptData(data []byte) ([]byte, error) {
+	return e.encryptDataAs(data, e.Format)
+}
+
+// encryptDataAs encrypts the given data for line mode in the given format, regardless of the configured one.
+func (e *Encryptor) encryptDataAs(data []byte, format Format) ([]byte, error) {
+	switch format {
+	case JWE:
+		return e.encryptJWE(data)
+	case Fernet:
+		return e.encryptFernet(data)
+	}
+
 	ciphertext, err := e.encryptBytes(data)
 	if err != nil {
 		return nil, err
@@ -19,8 +32,15 @@ func (e *Encryptor) encryptData(data []byte) ([]byte, error) {
 
 // decryptData decodes the base64 data and decrypts it.
 // This is used for line-mode decryption where the input is expected
-// to be base64 encoded ciphertext.
+// to be base64 encoded ciphertext, a compact JWE or a Fernet token.
 func (e *Encryptor) decryptData(data []byte) ([]byte, error) {
+	switch {
+	case isJWECompact(data):
+		return e.decryptJWE(data)
+	case isFernet(data):
+		return e.decryptFernet(data)
+	}
+
 	ciphertext, err := base64.StdEncoding.DecodeString(string(data))
 	if err != nil {
 		return nil, fmt.Errorf("decoding base64: %w", err)
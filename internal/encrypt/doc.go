@@ -1,4 +1,7 @@
 // Package encrypt provides a secure, flexible encryption system for handling both file and line-based encryption
-// operations using AES-CFB mode. It supports parallel processing for line-mode operations and maintains compatibility
+// operations with authenticated encryption. All ciphertext starts with a versioned header naming the cipher suite,
+// key derivation and key, from which decryption picks its path. Ciphertext written by earlier versions
+// with AES-CFB can still be decrypted.
+// It supports parallel processing for line-mode operations and maintains compatibility
 // with text-based workflows through automatic base64 encoding.
 package encrypt
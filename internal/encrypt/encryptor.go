@@ -1,8 +1,11 @@
 package encrypt
 
 import (
+	"bufio"
 	"fmt"
 	"io"
+	"sync"
+	"time"
 )
 
 // Directives defines the markers used to identify content for encryption/decryption.
@@ -17,20 +20,116 @@ type Directives struct {
 
 // Encryptor handles encryption and decryption operations.
 type Encryptor struct {
-	// Key is the encryption key used for AES cipher operations
-	Key []byte
+	// Recipients are the keys the data key is wrapped for when encrypting
+	Recipients []Recipient
+
+	// Identities are the keys tried to unwrap the data key when decrypting
+	Identities []Identity
 
 	// Operation specifies whether to encrypt or decrypt
 	Operation Operation
 
+	// Type specifies whether encryption is random or deterministic
+	Type Type
+
+	// Cipher specifies the cipher to encrypt with
+	Cipher Cipher
+
+	// Format specifies the ciphertext format to encrypt to
+	Format Format
+
+	// Armor encodes age output as PEM-like text, and OpenSSL output as base64
+	Armor bool
+
+	// Iterations is the PBKDF2 iteration count for the OpenSSL format, DefaultIterations if zero
+	Iterations int
+
+	// Digest is the PBKDF2 digest for the OpenSSL format, SHA256 if empty
+	Digest Digest
+
+	// JWEAlgorithm is the key management algorithm for the JWE format, JWEDirect if empty
+	JWEAlgorithm JWEAlgorithm
+
+	// TTL rejects Fernet tokens older than it on decryption, if not zero
+	TTL time.Duration
+
+	// VaultID labels Ansible Vault output, switching it to format version 1.2
+	VaultID string
+
 	// Mode determines whether to process the input line-by-line or as a whole file
 	Mode Mode
 
 	// Directives contains the markers used to identify content for processing
 	Directives Directives
 
+	// Context is bound into the key derived for each encryption, typically the file path.
+	// It is recorded in the header, so decryption does not depend on it.
+	Context string
+
 	// Parallel specifies the number of goroutines to use for parallel processing
 	Parallel int
+
+	// mu guards the fields below, shared between parallel workers
+	mu sync.Mutex
+
+	// header and key are shared by all encryptions, holding the wrapped data key
+	header *Header
+	key    []byte
+
+	// unwrapped caches data keys unwrapped when decrypting, by encoded stanzas
+	unwrapped map[string][]byte
+
+	// reencryptors caches the Encryptors for re-encrypting with the suite and context of the source ciphertext
+	reencryptors map[reencryption]*Encryptor
+}
+
+// reencryption identifies the suite and context ciphertext is re-encrypted with.
+type reencryption struct {
+	suite   Suite
+	context string
+}
+
+// FileFormat returns the format of the file-mode ciphertext the reader starts with, without consuming any input.
+// It reports false for input in none of the formats, such as plaintext, files with encrypted lines,
+// and ciphertext in the legacy AES-CFB format, which has no magic to detect it by.
+func FileFormat(reader *bufio.Reader) (Format, bool) {
+	switch {
+	case hasMagic(reader):
+		return GoCry, true
+	case isAge(reader):
+		return Age, true
+	case isVault(reader):
+		return AnsibleVault, true
+	case isOpenSSL(reader):
+		return OpenSSL, true
+	case isJWE(reader):
+		return JWE, true
+	default:
+		return "", false
+	}
+}
+
+// wholeFile reports how input starting with file-mode ciphertext is handled as a whole file, rather than by mode:
+// whether it is decrypted, or passed through unchanged.
+// In line mode, gocry file-mode ciphertext is passed through unchanged, as decrypting it would leave plaintext
+// that the clean side of a line filter does not encrypt again, as are age, Ansible Vault and OpenSSL files
+// unless their format is selected.
+// JWE is not detected in line mode, as a file with encrypted lines may well start with a token of its own.
+func (e *Encryptor) wholeFile(reader *bufio.Reader) (decrypt, passThrough bool) {
+	format, ok := FileFormat(reader)
+
+	switch {
+	case !ok:
+		return false, false
+	case e.Mode != Line:
+		return e.Operation == Decrypt, false
+	case format == JWE:
+		return false, false
+	case format == GoCry || format != e.Format:
+		return false, true
+	default:
+		return e.Operation == Decrypt, false
+	}
 }
 
 // Process handles encryption and decryption based on the provided configuration.
@@ -38,12 +137,38 @@ type Encryptor struct {
 // The processing mode (Line or File) determines how the input is handled:
 //   - Line mode processes the input line-by-line, maintaining order
 //   - File mode treats the entire input as a single block of data
+//
+// When decrypting, input that starts with a file-mode header, or is an age, Ansible Vault, OpenSSL or JWE file,
+// is decrypted as a whole file in file mode.
+// In line mode, input that starts with a file-mode header is passed through unchanged,
+// as are age, Ansible Vault and OpenSSL files unless their format is selected.
+// In line mode, the Ansible Vault format processes inline vault scalars instead of directives.
 func (e *Encryptor) Process(reader io.Reader, writer io.Writer) (bool, error) {
+	buffered := bufio.NewReader(reader)
+
+	switch decrypt, passThrough := e.wholeFile(buffered); {
+	case decrypt:
+		return e.processWholeFile(buffered, writer)
+	case passThrough:
+		if _, err := io.Copy(writer, buffered); err != nil {
+			return false, fmt.Errorf("%w: copying ciphertext: %w", ErrProcessing, err)
+		}
+
+		return false, nil
+	}
+
 	switch e.Mode {
 	case Line:
-		return e.processLines(reader, writer, e.Parallel)
+		switch {
+		case e.Format == AnsibleVault:
+			return e.processVaultLines(buffered, writer)
+		case e.Operation == Encrypt && (e.Format == Age || e.Format == OpenSSL):
+			return false, fmt.Errorf("%w: the %s format is only available in file mode", ErrProcessing, e.Format)
+		}
+
+		return e.processLines(buffered, writer, e.Parallel)
 	case File:
-		return e.processWholeFile(reader, writer)
+		return e.processWholeFile(buffered, writer)
 	default:
 		return false, fmt.Errorf("invalid mode: %s", e.Mode) //nolint: err113
 	}
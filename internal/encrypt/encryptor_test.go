@@ -0,0 +1,157 @@
+package encrypt
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestProcessWholeFiles checks which file-mode ciphertext is decrypted as a whole file in each mode,
+// and that line mode passes the rest through unchanged, so that a smudge and clean cycle under a line filter
+// neither leaves it decrypted nor rewrites its bytes.
+func TestProcessWholeFiles(t *testing.T) {
+	t.Parallel()
+
+	key := testSymmetricKey(t, 1)
+	plaintext := []byte("db_password: hunter2\r\nport: 22")
+
+	ageFile, err := processData(&Encryptor{
+		Operation:  Encrypt,
+		Format:     Age,
+		Armor:      true,
+		Recipients: []Recipient{NewPassphrase([]byte("ansible"), KDFScrypt)},
+	}, plaintext)
+	if err != nil {
+		t.Fatalf("encrypting age file: %v", err)
+	}
+
+	// openssl encrypts the plaintext in the OpenSSL format, binary or base64.
+	openssl := func(armor bool) []byte {
+		encrypted, err := processData(&Encryptor{
+			Operation:  Encrypt,
+			Format:     OpenSSL,
+			Armor:      armor,
+			Identities: []Identity{NewPassphrase([]byte("ansible"), KDFArgon2id)},
+		}, plaintext)
+		if err != nil {
+			t.Fatalf("encrypting OpenSSL file: %v", err)
+		}
+
+		return encrypted
+	}
+
+	opensslFile, opensslArmored := openssl(false), openssl(true)
+
+	directives := Directives{Encrypt: "### DIRECTIVE: ENCRYPT", Decrypt: "### DIRECTIVE: DECRYPT"}
+
+	tests := []struct {
+		name      string
+		input     []byte
+		mode      Mode
+		format    Format
+		operation Operation
+		want      []byte
+	}{
+		{
+			name:      "gocry in file mode",
+			input:     encryptTestStream(t, Random, AES, plaintext, key),
+			mode:      File,
+			operation: Decrypt,
+			want:      plaintext,
+		},
+		{
+			name:      "gocry decrypted in line mode",
+			input:     encryptTestStream(t, Random, AES, plaintext, key),
+			mode:      Line,
+			operation: Decrypt,
+		},
+		{
+			name:      "gocry encrypted in line mode",
+			input:     encryptTestStream(t, Random, AES, plaintext, key),
+			mode:      Line,
+			operation: Encrypt,
+		},
+		{
+			name:      "age decrypted in line mode",
+			input:     ageFile,
+			mode:      Line,
+			operation: Decrypt,
+		},
+		{
+			name:      "age selected in line mode",
+			input:     ageFile,
+			mode:      Line,
+			format:    Age,
+			operation: Decrypt,
+			want:      plaintext,
+		},
+		{
+			name:      "vault decrypted in line mode",
+			input:     []byte(vaultFile),
+			mode:      Line,
+			operation: Decrypt,
+		},
+		{
+			name:      "vault encrypted in line mode",
+			input:     []byte(vaultFile),
+			mode:      Line,
+			format:    AnsibleVault,
+			operation: Encrypt,
+		},
+		{
+			name:      "vault selected in line mode",
+			input:     []byte(vaultFile),
+			mode:      Line,
+			format:    AnsibleVault,
+			operation: Decrypt,
+			want:      []byte("db_user: admin\ndb_password: hunter2\n"),
+		},
+		{
+			name:      "openssl decrypted in line mode",
+			input:     opensslFile,
+			mode:      Line,
+			operation: Decrypt,
+		},
+		{
+			name:      "openssl base64 decrypted in line mode",
+			input:     opensslArmored,
+			mode:      Line,
+			operation: Decrypt,
+		},
+		{
+			name:      "openssl selected in line mode",
+			input:     opensslArmored,
+			mode:      Line,
+			format:    OpenSSL,
+			operation: Decrypt,
+			want:      plaintext,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			encryptor := keyEncryptor(Random, AES, key)
+			encryptor.Operation = test.operation
+			encryptor.Mode = test.mode
+			encryptor.Format = test.format
+			encryptor.Directives = directives
+			encryptor.Parallel = 1
+			encryptor.Identities = append(encryptor.Identities, NewPassphrase([]byte("ansible"), KDFScrypt))
+
+			output, err := processData(encryptor, test.input)
+
+			want := test.want
+			if want == nil {
+				want = test.input
+			}
+
+			switch {
+			case err != nil:
+				t.Fatalf("Process: %v", err)
+			case !bytes.Equal(output, want):
+				t.Fatalf("Process wrote %q, want %q", output, want)
+			}
+		})
+	}
+}
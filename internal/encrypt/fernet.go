@@ -0,0 +1,72 @@
+package encrypt
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/fernet/fernet-go"
+)
+
+// fernetPrefix starts every Fernet token, as the url-safe base64 encoding of the version byte
+// and the high bytes of the timestamp.
+const fernetPrefix = "gAAAAA"
+
+// isFernet reports whether data looks like a Fernet token rather than base64-encoded gocry ciphertext.
+func isFernet(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(fernetPrefix))
+}
+
+// fernetKeys returns the symmetric keys as Fernet keys,
+// whose first half is the HMAC-SHA256 signing key and second half the AES-128-CBC encryption key.
+func (e *Encryptor) fernetKeys() ([]*fernet.Key, error) {
+	keys, err := e.rawKeys(Fernet)
+	if err != nil {
+		return nil, err
+	}
+
+	fernetKeys := make([]*fernet.Key, 0, len(keys))
+
+	for _, key := range keys {
+		var fernetKey fernet.Key
+		if len(key) != len(fernetKey) {
+			return nil, fmt.Errorf("%w: Fernet keys must be %d bytes", ErrWrongKey, len(fernetKey))
+		}
+
+		copy(fernetKey[:], key)
+
+		fernetKeys = append(fernetKeys, &fernetKey)
+	}
+
+	return fernetKeys, nil
+}
+
+// encryptFernet encrypts the plaintext into a Fernet token with the first key, timestamped with the current time.
+func (e *Encryptor) encryptFernet(plaintext []byte) ([]byte, error) {
+	keys, err := e.fernetKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := fernet.EncryptAndSign(plaintext, keys[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: encrypting Fernet token: %w", ErrProcessing, err)
+	}
+
+	return token, nil
+}
+
+// decryptFernet verifies and decrypts a Fernet token, trying each key in turn.
+// With a TTL, tokens older than the TTL are rejected as well.
+func (e *Encryptor) decryptFernet(token []byte) ([]byte, error) {
+	keys, err := e.fernetKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext := fernet.VerifyAndDecrypt(token, e.TTL, keys)
+	if plaintext == nil {
+		return nil, fmt.Errorf("%w: wrong key, tampered or expired Fernet token", ErrAuthentication)
+	}
+
+	return plaintext, nil
+}
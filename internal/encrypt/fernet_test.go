@@ -0,0 +1,137 @@
+package encrypt
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fernet/fernet-go"
+)
+
+// Vectors of the Fernet specification (https://github.com/fernet/spec), from verify.json and invalid.json,
+// all for the secret fernetSecret. The tokens were issued in 1985.
+const (
+	fernetSecret = "cw_0x689RpI-jtRR7oE8h_eQsKImvJapLeSbXpwF4e4="
+
+	// fernetToken is "hello".
+	fernetToken = "gAAAAAAdwJ6wAAECAwQFBgcICQoLDA0ODy021cpGVWKZ_eEwCGM4BLLF_5CV9dOPmrhuVUPgJobwOz7JcbmrR64jVmpU4IwqDA=="
+)
+
+// TestFernetVectors decrypts the tokens of the Fernet specification in encrypted lines.
+func TestFernetVectors(t *testing.T) {
+	t.Parallel()
+
+	secret, err := base64.URLEncoding.DecodeString(fernetSecret)
+	if err != nil {
+		t.Fatalf("decoding secret: %v", err)
+	}
+
+	key, err := NewSymmetricKey(secret)
+	if err != nil {
+		t.Fatalf("NewSymmetricKey: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		key   *SymmetricKey
+		ttl   time.Duration
+		want  string
+	}{
+		{name: "verify", token: fernetToken, key: key, want: "hello"},
+		{name: "expired", token: fernetToken, key: key, ttl: time.Minute},
+		{name: "wrong key", token: fernetToken, key: testSymmetricKey(t, 1)},
+		{
+			name:  "incorrect mac",
+			token: "gAAAAAAdwJ6xAAECAwQFBgcICQoLDA0OD3HkMATM5lFqGaerZ-fWPAl1-szkFVzXTuGb4hR8AKtwcaX1YdykQUFBQUFBQUFBQQ==",
+			key:   key,
+		},
+		{
+			name:  "too short",
+			token: "gAAAAAAdwJ6xAAECAwQFBgcICQoLDA0OD3HkMATM5lFqGaerZ-fWPA==",
+			key:   key,
+		},
+		{
+			name:  "payload size not multiple of block size",
+			token: "gAAAAAAdwJ6xAAECAwQFBgcICQoLDA0OD3HkMATM5lFqGaerZ-fWPOm73QeoCk9uGib28Xe5vz6oxq5nmxbx_v7mrfyudzUm",
+			key:   key,
+		},
+		{
+			name:  "payload padding error",
+			token: "gAAAAAAdwJ6xAAECAwQFBgcICQoLDA0ODz4LEpdELGQAad7aNEHbf-JkLPIpuiYRLQ3RtXatOYREu2FWke6CnJNYIbkuKNqOhw==",
+			key:   key,
+		},
+	}
+
+	directives := Directives{Encrypt: "### DIRECTIVE: ENCRYPT", Decrypt: "### DIRECTIVE: DECRYPT"}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			decrypted, err := processData(&Encryptor{
+				Operation:  Decrypt,
+				Mode:       Line,
+				TTL:        test.ttl,
+				Directives: directives,
+				Identities: []Identity{test.key},
+				Parallel:   1,
+			}, []byte(directives.Decrypt+": "+test.token+"\n"))
+
+			switch {
+			case test.want == "" && !errors.Is(err, ErrAuthentication):
+				t.Fatalf("decrypting: error = %v, want %v", err, ErrAuthentication)
+			case test.want == "":
+				return
+			case err != nil:
+				t.Fatalf("decrypting: %v", err)
+			case string(decrypted) != test.want+"\n":
+				t.Fatalf("decrypted %q, want %q", decrypted, test.want+"\n")
+			}
+		})
+	}
+}
+
+// TestFernetRoundTrip encrypts lines into tokens for fernet-go to verify.
+func TestFernetRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	secret, err := base64.URLEncoding.DecodeString(fernetSecret)
+	if err != nil {
+		t.Fatalf("decoding secret: %v", err)
+	}
+
+	key, err := NewSymmetricKey(secret)
+	if err != nil {
+		t.Fatalf("NewSymmetricKey: %v", err)
+	}
+
+	directives := Directives{Encrypt: "### DIRECTIVE: ENCRYPT", Decrypt: "### DIRECTIVE: DECRYPT"}
+
+	encrypted, err := processData(&Encryptor{
+		Operation:  Encrypt,
+		Mode:       Line,
+		Format:     Fernet,
+		Directives: directives,
+		Recipients: []Recipient{key},
+		Identities: []Identity{key},
+		Parallel:   1,
+	}, []byte("password: hunter2 "+directives.Encrypt+"\n"))
+	if err != nil {
+		t.Fatalf("encrypting: %v", err)
+	}
+
+	token, ok := strings.CutPrefix(strings.TrimSuffix(string(encrypted), "\n"), directives.Decrypt+": ")
+	if !ok {
+		t.Fatalf("encrypted %q, want an encrypted line", encrypted)
+	}
+
+	fernetKey := fernet.MustDecodeKeys(fernetSecret)
+
+	plaintext := fernet.VerifyAndDecrypt([]byte(token), time.Minute, fernetKey)
+	if want := "password: hunter2 " + directives.Encrypt; string(plaintext) != want {
+		t.Fatalf("fernet-go decrypted %q, want %q", plaintext, want)
+	}
+}
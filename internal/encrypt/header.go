@@ -0,0 +1,262 @@
+package encrypt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// magic identifies authenticated gocry ciphertext, in both file and line mode.
+// Input that does not start with it is treated as legacy AES-CFB output.
+var magic = []byte("GOCRY")
+
+// headerVersion is the format version written right after the magic.
+// Versions 1 and 2 predate the header and are only supported for file-mode decryption.
+const headerVersion byte = 3
+
+// Header field tags. Each field is encoded as [1 byte tag][2 bytes big-endian length][value],
+// and the list of fields is terminated by tagEnd.
+// The stanza field is repeated once per recipient.
+const (
+	tagEnd byte = iota
+	tagSuite
+	tagKDF
+	tagKeyID
+	tagContext
+	tagStanza
+)
+
+// Suite identifies the cipher suite used to encrypt the payload.
+type Suite byte
+
+const (
+	// AES256GCM is AES-256 in Galois/Counter Mode with 12 bytes nonces.
+	AES256GCM Suite = 1
+
+	// AES256SIV is AES-256 in Synthetic Initialization Vector mode, used for deterministic encryption.
+	AES256SIV Suite = 2
+
+	// XChaCha20Poly1305 is XChaCha20-Poly1305 with 24 bytes nonces.
+	XChaCha20Poly1305 Suite = 3
+)
+
+// String returns the name of the cipher suite.
+func (s Suite) String() string {
+	switch s {
+	case AES256GCM:
+		return "aes-256-gcm"
+	case AES256SIV:
+		return "aes-256-siv"
+	case XChaCha20Poly1305:
+		return "xchacha20-poly1305"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(s))
+	}
+}
+
+// KDF identifies how the key material supplied by the user is turned into a key.
+type KDF byte
+
+const (
+	// KDFNone means the supplied key is used as is, as the input to the subkey derivation.
+	KDFNone KDF = 1
+
+	// KDFArgon2id derives the key from a passphrase with Argon2id.
+	KDFArgon2id KDF = 2
+
+	// KDFScrypt derives the key from a passphrase with scrypt.
+	KDFScrypt KDF = 3
+)
+
+// String returns the name of the key derivation function.
+func (k KDF) String() string {
+	switch k {
+	case KDFNone:
+		return "none"
+	case KDFArgon2id:
+		return "argon2id"
+	case KDFScrypt:
+		return "scrypt"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(k))
+	}
+}
+
+// Header describes how a piece of ciphertext was produced.
+// It is written in front of the ciphertext in both file and line mode,
+// so that decryption can pick the right path without any configuration.
+type Header struct {
+	// Suite is the cipher suite used for the payload
+	Suite Suite
+
+	// KDF is the key derivation function applied to the supplied key material,
+	// only set in headers without stanzas, where the key is used directly
+	KDF KDF
+
+	// KDFParams holds the salt and cost of passphrase-based key derivation
+	KDFParams KDFParams
+
+	// KeyID identifies the key the ciphertext was encrypted with, only set in headers without stanzas
+	KeyID []byte
+
+	// Context is bound into the per-file subkey, nil for ciphertext that uses the key directly
+	Context []byte
+
+	// Stanzas hold the data key, wrapped for each recipient
+	Stanzas []*Stanza
+}
+
+// ErrHeader indicates a malformed or unsupported header.
+var ErrHeader = errors.New("invalid header")
+
+// MarshalBinary encodes the header, including the magic and version.
+func (h *Header) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+
+	buf.Write(magic)
+	buf.WriteByte(headerVersion)
+
+	type field struct {
+		tag   byte
+		value []byte
+	}
+
+	fields := []field{{tagSuite, []byte{byte(h.Suite)}}}
+
+	if h.KDF != 0 {
+		fields = append(fields, field{tagKDF, encodeKDF(h.KDF, h.KDFParams)})
+	}
+
+	if len(h.KeyID) > 0 {
+		fields = append(fields, field{tagKeyID, h.KeyID})
+	}
+
+	if h.Context != nil {
+		fields = append(fields, field{tagContext, h.Context})
+	}
+
+	for _, stanza := range h.Stanzas {
+		fields = append(fields, field{tagStanza, stanza.marshal()})
+	}
+
+	for _, field := range fields {
+		if len(field.value) > 0xFFFF {
+			return nil, fmt.Errorf("%w: field %d too long", ErrHeader, field.tag)
+		}
+
+		buf.WriteByte(field.tag)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(len(field.value))))
+		buf.Write(field.value)
+	}
+
+	buf.WriteByte(tagEnd)
+
+	return buf.Bytes(), nil
+}
+
+// readHeader reads and parses a header from reader.
+// It returns the parsed header along with its raw bytes, as needed for authentication.
+func readHeader(reader io.Reader) (*Header, []byte, error) {
+	var raw bytes.Buffer
+
+	reader = io.TeeReader(reader, &raw)
+
+	prefix := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(reader, prefix); err != nil {
+		return nil, nil, fmt.Errorf("%w: reading magic: %w", ErrHeader, err)
+	}
+
+	if !bytes.Equal(prefix[:len(magic)], magic) {
+		return nil, nil, fmt.Errorf("%w: missing magic", ErrHeader)
+	}
+
+	if prefix[len(magic)] != headerVersion {
+		return nil, nil, fmt.Errorf("%w: unsupported version %d", ErrHeader, prefix[len(magic)])
+	}
+
+	header := &Header{}
+
+	for {
+		var tag [1]byte
+		if _, err := io.ReadFull(reader, tag[:]); err != nil {
+			return nil, nil, fmt.Errorf("%w: reading field: %w", ErrHeader, err)
+		}
+
+		if tag[0] == tagEnd {
+			break
+		}
+
+		var length [2]byte
+		if _, err := io.ReadFull(reader, length[:]); err != nil {
+			return nil, nil, fmt.Errorf("%w: reading field length: %w", ErrHeader, err)
+		}
+
+		value := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(reader, value); err != nil {
+			return nil, nil, fmt.Errorf("%w: reading field value: %w", ErrHeader, err)
+		}
+
+		if err := header.setField(tag[0], value); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if header.Suite == 0 || (header.KDF == 0 && len(header.Stanzas) == 0) {
+		return nil, nil, fmt.Errorf("%w: missing suite or recipients", ErrHeader)
+	}
+
+	return header, raw.Bytes(), nil
+}
+
+// setField stores a decoded field value in the header.
+func (h *Header) setField(tag byte, value []byte) error {
+	switch tag {
+	case tagSuite:
+		if len(value) != 1 {
+			return fmt.Errorf("%w: invalid suite field", ErrHeader)
+		}
+
+		h.Suite = Suite(value[0])
+	case tagKDF:
+		kdf, params, err := decodeKDF(value)
+		if err != nil {
+			return err
+		}
+
+		h.KDF, h.KDFParams = kdf, params
+	case tagKeyID:
+		h.KeyID = value
+	case tagContext:
+		h.Context = value
+	case tagStanza:
+		stanza, err := unmarshalStanza(value)
+		if err != nil {
+			return err
+		}
+
+		h.Stanzas = append(h.Stanzas, stanza)
+	default:
+		return fmt.Errorf("%w: unknown field %d", ErrHeader, tag)
+	}
+
+	return nil
+}
+
+// HasHeader reports whether the reader starts with file-mode ciphertext, without consuming any input.
+func HasHeader(reader *bufio.Reader) bool {
+	return hasMagic(reader)
+}
+
+// hasMagic reports whether the reader starts with the magic followed by a known version,
+// without consuming any input.
+func hasMagic(reader *bufio.Reader) bool {
+	prefix, err := reader.Peek(len(magic) + 1)
+	if err != nil || !bytes.Equal(prefix[:len(magic)], magic) {
+		return false
+	}
+
+	return prefix[len(magic)] >= 1 && prefix[len(magic)] <= headerVersion
+}
@@ -0,0 +1,215 @@
+package encrypt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	jose "github.com/go-jose/go-jose/v4"
+)
+
+// JWEAlgorithm is the JWE key management algorithm, as in the "alg" header parameter.
+type JWEAlgorithm string
+
+const (
+	// JWEDirect uses the key directly as the A256GCM content encryption key.
+	JWEDirect JWEAlgorithm = "dir"
+
+	// JWEA256KW wraps a random content encryption key with the key, using AES Key Wrap.
+	JWEA256KW JWEAlgorithm = "A256KW"
+)
+
+// jwePrefix starts every compact JWE, as the base64url encoding of the opening `{"` of the JSON header.
+const jwePrefix = "eyJ"
+
+// jweParts is the number of dot-separated parts of a compact JWE.
+const jweParts = 5
+
+// isJWE reports whether the reader starts with a compact JWE, without consuming any input.
+// Input longer than the buffer of the reader is checked as far as it is buffered.
+func isJWE(reader *bufio.Reader) bool {
+	peeked, err := reader.Peek(reader.Size())
+
+	switch {
+	case errors.Is(err, io.EOF):
+		return isJWECompact(bytes.TrimSpace(peeked))
+	case err != nil:
+		return false
+	}
+
+	parts := bytes.Split(peeked, []byte("."))
+	if len(parts) < 2 || len(parts) > jweParts || !isJWEHeader(parts[0]) {
+		return false
+	}
+
+	for _, part := range parts[1:] {
+		if !isBase64URL(part) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isJWECompact reports whether data is a compact JWE rather than base64-encoded gocry ciphertext or another token:
+// five dot-separated base64url parts, the first a JSON header with a content encryption algorithm.
+func isJWECompact(data []byte) bool {
+	parts := bytes.Split(data, []byte("."))
+	if len(parts) != jweParts || !isJWEHeader(parts[0]) {
+		return false
+	}
+
+	for _, part := range parts[1:] {
+		if !isBase64URL(part) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isJWEHeader reports whether part is the base64url-encoded JSON header of a JWE, which sets "enc",
+// unlike the header of a JWS such as a JWT.
+func isJWEHeader(part []byte) bool {
+	if !bytes.HasPrefix(part, []byte(jwePrefix)) {
+		return false
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(string(part))
+	if err != nil {
+		return false
+	}
+
+	var header struct {
+		Enc string `json:"enc"`
+	}
+
+	return json.Unmarshal(decoded, &header) == nil && header.Enc != ""
+}
+
+// isBase64URL reports whether part only holds characters of unpadded base64url.
+func isBase64URL(part []byte) bool {
+	for _, char := range part {
+		switch {
+		case char >= 'A' && char <= 'Z', char >= 'a' && char <= 'z', char >= '0' && char <= '9', char == '-', char == '_':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// encryptJWE encrypts the plaintext into an RFC 7516 compact JWE with A256GCM content encryption,
+// using the first key either directly or to wrap the content encryption key.
+func (e *Encryptor) encryptJWE(plaintext []byte) ([]byte, error) {
+	keys, err := e.rawKeys(JWE)
+	if err != nil {
+		return nil, err
+	}
+
+	algorithm := jose.DIRECT
+	if e.JWEAlgorithm == JWEA256KW {
+		algorithm = jose.A256KW
+	}
+
+	encrypter, err := jose.NewEncrypter(jose.A256GCM, jose.Recipient{Algorithm: algorithm, Key: keys[0]}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: creating JWE encrypter: %w", ErrProcessing, err)
+	}
+
+	object, err := encrypter.Encrypt(plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("%w: encrypting JWE: %w", ErrProcessing, err)
+	}
+
+	token, err := object.CompactSerialize()
+	if err != nil {
+		return nil, fmt.Errorf("%w: serializing JWE: %w", ErrProcessing, err)
+	}
+
+	return []byte(token), nil
+}
+
+// decryptJWE decrypts a compact JWE using dir or A256KW with A256GCM, trying each key in turn.
+func (e *Encryptor) decryptJWE(token []byte) ([]byte, error) {
+	keys, err := e.rawKeys(JWE)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := jose.ParseEncryptedCompact(string(token),
+		[]jose.KeyAlgorithm{jose.DIRECT, jose.A256KW}, []jose.ContentEncryption{jose.A256GCM})
+	if err != nil {
+		return nil, fmt.Errorf("%w: parsing JWE: %w", ErrProcessing, err)
+	}
+
+	for _, key := range keys {
+		if plaintext, err := object.Decrypt(key); err == nil {
+			return plaintext, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: wrong key or tampered JWE", ErrAuthentication)
+}
+
+// encryptJWEFile encrypts the whole input from reader into a compact JWE, followed by a newline.
+func (e *Encryptor) encryptJWEFile(reader io.Reader, writer io.Writer) error {
+	plaintext, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("reading data: %w", err)
+	}
+
+	token, err := e.encryptJWE(plaintext)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(writer, "%s\n", token); err != nil {
+		return fmt.Errorf("writing encrypted data: %w", err)
+	}
+
+	return nil
+}
+
+// decryptJWEFile decrypts a compact JWE read from reader, ignoring surrounding whitespace.
+func (e *Encryptor) decryptJWEFile(reader io.Reader, writer io.Writer) error {
+	token, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("reading encrypted data: %w", err)
+	}
+
+	plaintext, err := e.decryptJWE(bytes.TrimSpace(token))
+	if err != nil {
+		return err
+	}
+
+	if _, err := writer.Write(plaintext); err != nil {
+		return fmt.Errorf("writing decrypted data: %w", err)
+	}
+
+	return nil
+}
+
+// reencryptJWE decrypts the compact JWE with e and encrypts it with the keys of to into a JWE file,
+// with the same key management algorithm.
+func (e *Encryptor) reencryptJWE(token []byte, writer io.Writer, to *Encryptor) error {
+	plaintext, err := e.decryptJWE(token)
+	if err != nil {
+		return err
+	}
+
+	object, err := jose.ParseEncryptedCompact(string(token),
+		[]jose.KeyAlgorithm{jose.DIRECT, jose.A256KW}, []jose.ContentEncryption{jose.A256GCM})
+	if err != nil {
+		return fmt.Errorf("%w: parsing JWE: %w", ErrProcessing, err)
+	}
+
+	encryptor := &Encryptor{Identities: to.Identities, JWEAlgorithm: JWEAlgorithm(object.Header.Algorithm)}
+
+	return encryptor.encryptJWEFile(bytes.NewReader(plaintext), writer)
+}
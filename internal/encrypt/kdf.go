@@ -0,0 +1,175 @@
+package encrypt
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// saltSize is the size of the random salt for passphrase-based key derivation.
+const saltSize = 16
+
+// Default cost parameters, following the second recommendation of RFC 9106 for Argon2id,
+// and the parameters used by age for scrypt.
+const (
+	argon2idTime    = 3
+	argon2idMemory  = 64 * 1024 // KiB
+	argon2idThreads = 4
+
+	scryptLogN = 18
+	scryptR    = 8
+	scryptP    = 1
+)
+
+// Upper bounds for cost parameters read from a header, to refuse
+// ciphertext that would make decryption exhaust memory or time.
+const (
+	maxArgon2idTime   = 16
+	maxArgon2idMemory = 1024 * 1024 // KiB
+	maxScryptLogN     = 22
+	maxScryptRP       = 1 << 10
+)
+
+// KDFParams holds the salt and cost parameters of a passphrase-based key derivation.
+// Argon2id uses Time, Memory and Threads; scrypt uses LogN, R and P.
+type KDFParams struct {
+	// Salt is the random per-ciphertext salt
+	Salt []byte
+
+	// Time is the number of Argon2id passes
+	Time uint32
+
+	// Memory is the Argon2id memory size in KiB
+	Memory uint32
+
+	// Threads is the Argon2id degree of parallelism
+	Threads uint8
+
+	// LogN is the base-2 logarithm of the scrypt CPU/memory cost
+	LogN uint8
+
+	// R is the scrypt block size
+	R uint32
+
+	// P is the scrypt parallelization parameter
+	P uint32
+}
+
+// newKDFParams returns a fresh salt and the default cost parameters for the key derivation function.
+func newKDFParams(kdf KDF) (KDFParams, error) {
+	params := KDFParams{Salt: make([]byte, saltSize)}
+
+	if _, err := io.ReadFull(rand.Reader, params.Salt); err != nil {
+		return params, fmt.Errorf("generating salt: %w", err)
+	}
+
+	switch kdf {
+	case KDFArgon2id:
+		params.Time, params.Memory, params.Threads = argon2idTime, argon2idMemory, argon2idThreads
+	case KDFScrypt:
+		params.LogN, params.R, params.P = scryptLogN, scryptR, scryptP
+	default:
+		return params, fmt.Errorf("%w: unsupported key derivation %s", ErrProcessing, kdf)
+	}
+
+	return params, nil
+}
+
+// deriveFromPassphrase derives a key from the passphrase with the given function and parameters.
+func deriveFromPassphrase(kdf KDF, params KDFParams, passphrase []byte) ([]byte, error) {
+	switch kdf {
+	case KDFArgon2id:
+		return argon2.IDKey(passphrase, params.Salt, params.Time, params.Memory, params.Threads, aesKeySize), nil
+	case KDFScrypt:
+		key, err := scrypt.Key(passphrase, params.Salt, 1<<params.LogN, int(params.R), int(params.P), aesKeySize)
+		if err != nil {
+			return nil, fmt.Errorf("deriving key with scrypt: %w", err)
+		}
+
+		return key, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported key derivation %s", ErrProcessing, kdf)
+	}
+}
+
+// encodeKDF encodes the key derivation header field: [1 byte function][parameters].
+// The parameters are the salt followed by the cost, all integers in big-endian:
+//   - Argon2id: [16 bytes salt][4 bytes time][4 bytes memory][1 byte threads]
+//   - scrypt: [16 bytes salt][1 byte log2(N)][4 bytes r][4 bytes p]
+func encodeKDF(kdf KDF, params KDFParams) []byte {
+	value := []byte{byte(kdf)}
+
+	switch kdf {
+	case KDFArgon2id:
+		value = append(value, params.Salt...)
+		value = binary.BigEndian.AppendUint32(value, params.Time)
+		value = binary.BigEndian.AppendUint32(value, params.Memory)
+		value = append(value, params.Threads)
+	case KDFScrypt:
+		value = append(value, params.Salt...)
+		value = append(value, params.LogN)
+		value = binary.BigEndian.AppendUint32(value, params.R)
+		value = binary.BigEndian.AppendUint32(value, params.P)
+	}
+
+	return value
+}
+
+// decodeKDF decodes and checks the key derivation header field written by encodeKDF.
+func decodeKDF(value []byte) (KDF, KDFParams, error) {
+	var params KDFParams
+
+	if len(value) == 0 {
+		return 0, params, fmt.Errorf("%w: empty key derivation field", ErrHeader)
+	}
+
+	kdf, value := KDF(value[0]), value[1:]
+
+	const costSize = 9
+
+	switch kdf {
+	case KDFNone:
+		if len(value) != 0 {
+			return 0, params, fmt.Errorf("%w: invalid key derivation field", ErrHeader)
+		}
+
+		return kdf, params, nil
+	case KDFArgon2id, KDFScrypt:
+		if len(value) != saltSize+costSize {
+			return 0, params, fmt.Errorf("%w: invalid key derivation field", ErrHeader)
+		}
+	default:
+		return 0, params, fmt.Errorf("%w: unsupported key derivation %s", ErrHeader, kdf)
+	}
+
+	params.Salt, value = value[:saltSize], value[saltSize:]
+
+	if kdf == KDFArgon2id {
+		params.Time = binary.BigEndian.Uint32(value[0:4])
+		params.Memory = binary.BigEndian.Uint32(value[4:8])
+		params.Threads = value[8]
+
+		if params.Time == 0 || params.Time > maxArgon2idTime ||
+			params.Threads == 0 || params.Memory < 8*uint32(params.Threads) || params.Memory > maxArgon2idMemory {
+			return 0, params, fmt.Errorf("%w: Argon2id parameters out of range", ErrHeader)
+		}
+
+		return kdf, params, nil
+	}
+
+	params.LogN = value[0]
+	params.R = binary.BigEndian.Uint32(value[1:5])
+	params.P = binary.BigEndian.Uint32(value[5:9])
+
+	if params.LogN == 0 || params.LogN > maxScryptLogN ||
+		params.R == 0 || params.P == 0 || params.R > maxScryptRP || params.P > maxScryptRP ||
+		params.R*params.P > maxScryptRP {
+		return 0, params, fmt.Errorf("%w: scrypt parameters out of range", ErrHeader)
+	}
+
+	return kdf, params, nil
+}
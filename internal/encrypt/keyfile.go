@@ -0,0 +1,64 @@
+package encrypt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/pem"
+	"fmt"
+)
+
+// protectedKeyType is the PEM type of passphrase-protected key files.
+const protectedKeyType = "GOCRY ENCRYPTED KEY"
+
+// IsProtectedKey reports whether the content of a key file is protected with a passphrase.
+func IsProtectedKey(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN "+protectedKeyType+"-----"))
+}
+
+// ProtectKey encrypts the raw key with a key derived from the passphrase with scrypt,
+// as file-mode ciphertext in a PEM block, the way encrypted SSH private keys are stored.
+func ProtectKey(key, passphrase []byte) ([]byte, error) {
+	encryptor := &Encryptor{
+		Recipients: []Recipient{NewPassphrase(passphrase, KDFScrypt)},
+		Operation:  Encrypt,
+		Type:       Random,
+		Cipher:     AES,
+		Mode:       File,
+		Context:    protectedKeyType,
+	}
+
+	var ciphertext bytes.Buffer
+
+	if err := encryptor.encryptStream(bytes.NewReader(key), &ciphertext); err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: protectedKeyType, Bytes: ciphertext.Bytes()}), nil
+}
+
+// UnprotectKey decrypts a key file protected with ProtectKey, returning the raw key.
+func UnprotectKey(data, passphrase []byte) ([]byte, error) {
+	block, _ := pem.Decode(bytes.TrimSpace(data))
+	if block == nil || block.Type != protectedKeyType {
+		return nil, fmt.Errorf("%w: malformed protected key file", ErrHeader)
+	}
+
+	reader := bufio.NewReader(bytes.NewReader(block.Bytes))
+	if !hasMagic(reader) {
+		return nil, fmt.Errorf("%w: malformed protected key file", ErrHeader)
+	}
+
+	encryptor := &Encryptor{
+		Identities: []Identity{NewPassphrase(passphrase, KDFScrypt)},
+		Operation:  Decrypt,
+		Mode:       File,
+	}
+
+	var key bytes.Buffer
+
+	if err := encryptor.decryptStream(reader, &key); err != nil {
+		return nil, err
+	}
+
+	return key.Bytes(), nil
+}
@@ -0,0 +1,259 @@
+package encrypt
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Labels used to derive independent subkeys from the supplied key.
+const (
+	infoPayload = "gocry/v3/payload"
+	infoHeader  = "gocry/v3/header"
+	infoLine    = "gocry/v3/line"
+	infoKeyID   = "gocry/v3/key-id"
+	infoContext = "gocry/v3/context\x00"
+	infoWrap    = "gocry/v3/wrap"
+
+	infoDeterministic = "gocry/v3/deterministic\x00"
+)
+
+// keyIDSize is the size of the key identifier stored in the header.
+const keyIDSize = 8
+
+// deriveKey expands secret into a subkey of the given size, bound to info, using HKDF-SHA256.
+func deriveKey(secret []byte, info string, size int) ([]byte, error) {
+	key := make([]byte, size)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, nil, []byte(info)), key); err != nil {
+		return nil, fmt.Errorf("deriving key: %w", err)
+	}
+
+	return key, nil
+}
+
+// keyID returns a short identifier for the key, which doubles as a key check value.
+// It is derived with HMAC so that it reveals nothing about the key itself.
+func keyID(key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(infoKeyID))
+
+	return mac.Sum(nil)[:keyIDSize]
+}
+
+// Fingerprint returns the fingerprint of the key, as recorded in the header of ciphertext encrypted with it.
+func Fingerprint(key []byte) string {
+	return hex.EncodeToString(keyID(key))
+}
+
+// contextKey derives the subkey bound to the context from key, so that each file
+// (or purpose) is encrypted under its own key, and the key itself is never used directly.
+// A nil context, as found in ciphertext predating subkeys, returns the key as is.
+func contextKey(key, context []byte) ([]byte, error) {
+	if context == nil {
+		return key, nil
+	}
+
+	return deriveKey(key, infoContext+string(context), len(key))
+}
+
+// headerMAC authenticates the raw header bytes with a subkey of key.
+func headerMAC(key, header []byte) ([]byte, error) {
+	macKey, err := deriveKey(key, infoHeader, sha256.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(header)
+
+	return mac.Sum(nil), nil
+}
+
+// newHeader returns the header for encrypting with the configured recipients, type and cipher,
+// along with the key material to encrypt with, bound to the context.
+// Deterministic encryption is only available with AES and takes precedence over the cipher.
+//
+// A single data key is generated per Encryptor and wrapped for all recipients, so that
+// all lines encrypted in one run share the header and (possibly slow) wrapping runs only once.
+func (e *Encryptor) newHeader() (*Header, []byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.header == nil {
+		header, key, err := e.wrapDataKey()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		e.header, e.key = header, key
+	}
+
+	return e.header, e.key, nil
+}
+
+// wrapDataKey creates a new header holding a data key wrapped for each recipient,
+// and returns it along with the data key bound to the context.
+func (e *Encryptor) wrapDataKey() (*Header, []byte, error) {
+	if len(e.Recipients) == 0 {
+		return nil, nil, fmt.Errorf("%w: no recipients to encrypt for", ErrProcessing)
+	}
+
+	header := &Header{Suite: AES256GCM, Context: []byte(e.Context)}
+
+	switch {
+	case e.Type == Deterministic:
+		header.Suite = AES256SIV
+	case e.Cipher == XChaCha20:
+		header.Suite = XChaCha20Poly1305
+	}
+
+	dataKey := make([]byte, dataKeySize)
+
+	if e.Type == Deterministic {
+		// A random data key would defeat deterministic encryption, so derive it from the first key instead.
+		// Wrapping with AES-SIV is deterministic as well, which makes the whole header reproducible.
+		keys := make([]*SymmetricKey, 0, len(e.Recipients))
+
+		for _, recipient := range e.Recipients {
+			key, ok := recipient.(*SymmetricKey)
+			if !ok {
+				return nil, nil, fmt.Errorf("%w: deterministic encryption requires symmetric keys only", ErrProcessing)
+			}
+
+			keys = append(keys, key)
+		}
+
+		var err error
+		if dataKey, err = keys[0].deterministicDataKey(header.Context); err != nil {
+			return nil, nil, err
+		}
+	} else if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, nil, fmt.Errorf("generating data key: %w", err)
+	}
+
+	for _, recipient := range e.Recipients {
+		stanza, err := recipient.Wrap(dataKey)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		header.Stanzas = append(header.Stanzas, stanza)
+	}
+
+	key, err := contextKey(dataKey, header.Context)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return header, key, nil
+}
+
+// keyFor returns the key material for decrypting ciphertext with the given header,
+// bound to the context recorded in the header.
+// It fails with ErrWrongKey if none of the identities can unwrap the data key.
+func (e *Encryptor) keyFor(header *Header) ([]byte, error) {
+	var (
+		key []byte
+		err error
+	)
+
+	if len(header.Stanzas) == 0 {
+		key, err = e.directKey(header)
+	} else {
+		key, err = e.unwrap(header.Stanzas)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return contextKey(key, header.Context)
+}
+
+// unwrap returns the data key wrapped in the stanzas for any of the identities.
+// Unwrapped keys are cached, as all lines encrypted in one run share the same stanzas.
+func (e *Encryptor) unwrap(stanzas []*Stanza) ([]byte, error) {
+	var id []byte
+	for _, stanza := range stanzas {
+		value := stanza.marshal()
+		id = binary.BigEndian.AppendUint16(id, uint16(len(value)))
+		id = append(id, value...)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if key, ok := e.unwrapped[string(id)]; ok {
+		return key, nil
+	}
+
+	for _, identity := range e.Identities {
+		for _, stanza := range stanzas {
+			key, err := identity.Unwrap(stanza)
+			if errors.Is(err, errNotRecipient) {
+				continue
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			if e.unwrapped == nil {
+				e.unwrapped = make(map[string][]byte)
+			}
+
+			e.unwrapped[string(id)] = key
+
+			return key, nil
+		}
+	}
+
+	return nil, wrongKeyError(stanzas, e.Identities)
+}
+
+// directKey returns the key for headers without stanzas, written before data keys were wrapped
+// for recipients, where the supplied key (or the key derived from the passphrase) is used directly.
+func (e *Encryptor) directKey(header *Header) ([]byte, error) {
+	for _, identity := range e.Identities {
+		var key []byte
+
+		switch identity := identity.(type) {
+		case *SymmetricKey:
+			if header.KDF != KDFNone {
+				continue
+			}
+
+			key = identity.key
+		case *Passphrase:
+			if header.KDF == KDFNone {
+				continue
+			}
+
+			var err error
+			if key, err = identity.derive(header.KDF, header.KDFParams); err != nil {
+				return nil, err
+			}
+		default:
+			continue
+		}
+
+		// Headers without a key identifier are accepted, leaving detection to authentication.
+		if len(header.KeyID) == 0 || hmac.Equal(header.KeyID, keyID(key)) {
+			return key, nil
+		}
+	}
+
+	stanza := &Stanza{Type: StanzaKey, Args: header.KeyID}
+	if header.KDF != KDFNone {
+		stanza = &Stanza{Type: StanzaPassphrase, Args: encodeKDF(header.KDF, header.KDFParams)}
+	}
+
+	return nil, wrongKeyError([]*Stanza{stanza}, e.Identities)
+}
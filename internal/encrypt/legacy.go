@@ -0,0 +1,192 @@
+package encrypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// This file holds the decryption of formats written by earlier versions of gocry.
+// They are never produced anymore, but must remain readable.
+
+// legacyKey returns the key for decrypting legacy formats, which predate passphrases and recipients.
+// These formats carry no key identifier, so the first symmetric key is used.
+func (e *Encryptor) legacyKey() ([]byte, error) {
+	for _, identity := range e.Identities {
+		if key, ok := identity.(*SymmetricKey); ok {
+			return key.key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: ciphertext from an earlier version requires a key, not a passphrase", ErrProcessing)
+}
+
+// HasLegacyLines reports whether the encrypted lines read from reader include any in the legacy AES-CFB format.
+// That format is not authenticated, so decrypting it succeeds with any key, and cannot tell whether the key is right.
+func (e *Encryptor) HasLegacyLines(reader io.Reader) bool {
+	prefix := e.Directives.Decrypt + ": "
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		if encrypted, ok := strings.CutPrefix(scanner.Text(), prefix); ok && isLegacyLine([]byte(encrypted)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isLegacyLine reports whether line ciphertext is in the legacy AES-CFB format, i.e. base64 without the magic.
+func isLegacyLine(encrypted []byte) bool {
+	if isJWECompact(encrypted) || isFernet(encrypted) {
+		return false
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(string(encrypted))
+
+	return err == nil && !bytes.HasPrefix(ciphertext, magic)
+}
+
+// decryptBytesCFB decrypts line-mode ciphertext written before the header was introduced,
+// using AES-CFB mode.
+// It expects the input to be in the format: [16 bytes IV][variable-length ciphertext].
+// Returns the original plaintext on success.
+func (e *Encryptor) decryptBytesCFB(ciphertext []byte) ([]byte, error) {
+	// Verify minimum length requirement for IV
+	if len(ciphertext) < aes.BlockSize {
+		return nil, fmt.Errorf("%w: ciphertext too short", ErrProcessing)
+	}
+
+	key, err := e.legacyKey()
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+
+	// Extract IV and actual ciphertext
+	iv := ciphertext[:aes.BlockSize]
+	ciphertext = ciphertext[aes.BlockSize:]
+
+	// Decrypt data using CFB mode
+	stream := cipher.NewCFBDecrypter(block, iv)
+	stream.XORKeyStream(ciphertext, ciphertext) // Decryption happens in-place
+
+	return ciphertext, nil
+}
+
+// decryptStreamCFB decrypts data from reader to writer using AES-CFB mode.
+// It is kept to read files written before authenticated encryption was introduced.
+// It expects the IV to be prepended to the encrypted data.
+// The decryption is done in chunks to maintain constant memory usage.
+func (e *Encryptor) decryptStreamCFB(reader io.Reader, writer io.Writer) error {
+	// Read the prepended IV
+	initializationVector := make([]byte, aes.BlockSize)
+
+	n, err := io.ReadFull(reader, initializationVector)
+	if err != nil {
+		return fmt.Errorf("reading IV: %w", err)
+	}
+
+	if n < aes.BlockSize {
+		return fmt.Errorf("%w: IV too short", ErrProcessing)
+	}
+
+	key, err := e.legacyKey()
+	if err != nil {
+		return err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("creating cipher: %w", err)
+	}
+
+	stream := cipher.NewCFBDecrypter(block, initializationVector)
+	// Use fixed-size buffers for reading and decryption
+	const bufferSize = 4096
+
+	buf := make([]byte, bufferSize)
+	decrypted := make([]byte, bufferSize)
+
+	for {
+		n, err := reader.Read(buf)
+		if n > 0 {
+			stream.XORKeyStream(decrypted[:n], buf[:n])
+
+			if _, err := writer.Write(decrypted[:n]); err != nil {
+				return fmt.Errorf("writing decrypted data: %w", err)
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return fmt.Errorf("reading encrypted data: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// decryptStreamPreHeader decrypts files written in format versions 1 and 2,
+// which start with the magic and version only and use the key directly with AES-256-GCM:
+//   - version 1: [magic][version][12 bytes nonce][ciphertext][16 bytes tag], sealed at once
+//   - version 2: [magic][version][7 bytes nonce prefix][chunk]...[final chunk]
+//
+// In both, the magic and version are authenticated as additional data.
+func (e *Encryptor) decryptStreamPreHeader(reader io.Reader, writer io.Writer) error {
+	prefix := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(reader, prefix); err != nil {
+		return fmt.Errorf("%w: reading header: %w", ErrProcessing, err)
+	}
+
+	key, err := e.legacyKey()
+	if err != nil {
+		return err
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+
+	if prefix[len(magic)] == 2 {
+		noncePrefix := make([]byte, noncePrefixSize(aead))
+		if _, err := io.ReadFull(reader, noncePrefix); err != nil {
+			return fmt.Errorf("%w: reading nonce prefix: %w", ErrProcessing, err)
+		}
+
+		return openChunks(aead, noncePrefix, prefix, reader, writer)
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("reading encrypted data: %w", err)
+	}
+
+	if len(data) < aead.NonceSize()+aead.Overhead() {
+		return fmt.Errorf("%w: ciphertext too short", ErrProcessing)
+	}
+
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], prefix)
+	if err != nil {
+		return fmt.Errorf("%w: wrong key or tampered ciphertext", ErrAuthentication)
+	}
+
+	if _, err := writer.Write(plaintext); err != nil {
+		return fmt.Errorf("writing decrypted data: %w", err)
+	}
+
+	return nil
+}
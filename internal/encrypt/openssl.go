@@ -0,0 +1,298 @@
+package encrypt
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha1" //nolint: gosec
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// opensslMagic starts the output of `openssl enc -salt`, followed by the salt.
+	opensslMagic = "Salted__"
+
+	// opensslBase64Magic is the base64 encoding of opensslMagic, starting the output of `openssl enc -a`.
+	opensslBase64Magic = "U2FsdGVkX1"
+
+	// opensslSaltSize is the size of the salt following the magic.
+	opensslSaltSize = 8
+
+	// opensslLineWidth is the line width of base64 output, as with `openssl enc -a`.
+	opensslLineWidth = 64
+
+	// DefaultIterations is the PBKDF2 iteration count used by `openssl enc -pbkdf2`.
+	DefaultIterations = 10000
+)
+
+// Digest names the hash function used with PBKDF2 in the OpenSSL format, as given to `openssl enc -md`.
+type Digest string
+
+const (
+	// SHA1 is SHA-1, only for decrypting old artifacts.
+	SHA1 Digest = "sha1"
+
+	// SHA256 is SHA-256, the default of `openssl enc`.
+	SHA256 Digest = "sha256"
+
+	// SHA512 is SHA-512.
+	SHA512 Digest = "sha512"
+)
+
+// hash returns the hash function for the digest.
+func (d Digest) hash() (func() hash.Hash, error) {
+	switch d {
+	case SHA1:
+		return sha1.New, nil
+	case SHA256, "":
+		return sha256.New, nil
+	case SHA512:
+		return sha512.New, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported digest %q", ErrProcessing, d)
+	}
+}
+
+// isOpenSSL reports whether the reader starts with the output of `openssl enc -salt`, binary or base64,
+// without consuming any input.
+func isOpenSSL(reader *bufio.Reader) bool {
+	return hasPrefix(reader, opensslMagic) || hasPrefix(reader, opensslBase64Magic)
+}
+
+// opensslCipher derives the AES-256 key and IV from the password and salt with PBKDF2,
+// as `openssl enc -aes-256-cbc -pbkdf2` does, and returns the block cipher and IV.
+func (e *Encryptor) opensslCipher(salt []byte) (cipher.Block, []byte, error) {
+	password, err := e.password(OpenSSL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	digest, err := e.Digest.hash()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	iterations := e.Iterations
+	if iterations == 0 {
+		iterations = DefaultIterations
+	}
+
+	derived := pbkdf2.Key(password, salt, iterations, aesKeySize+aes.BlockSize, digest)
+
+	block, err := aes.NewCipher(derived[:aesKeySize])
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating cipher: %w", err)
+	}
+
+	return block, derived[aesKeySize:], nil
+}
+
+// encryptOpenSSL encrypts data from reader to writer in the format of `openssl enc -aes-256-cbc -pbkdf2 -salt`:
+// [Salted__][8 bytes salt][AES-256-CBC ciphertext with PKCS#7 padding], base64-encoded if Armor is set.
+// The iteration count and digest are not recorded, and must be given again for decryption.
+// The encryption is done in chunks to maintain constant memory usage.
+func (e *Encryptor) encryptOpenSSL(reader io.Reader, writer io.Writer) error {
+	salt := make([]byte, opensslSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return fmt.Errorf("generating salt: %w", err)
+	}
+
+	block, iv, err := e.opensslCipher(salt)
+	if err != nil {
+		return err
+	}
+
+	output := writer
+
+	var encoder io.WriteCloser
+
+	if e.Armor {
+		encoder = base64.NewEncoder(base64.StdEncoding, &lineWriter{writer: writer, width: opensslLineWidth})
+		output = encoder
+	}
+
+	if _, err := io.WriteString(output, opensslMagic+string(salt)); err != nil {
+		return fmt.Errorf("writing header: %w", err)
+	}
+
+	mode := cipher.NewCBCEncrypter(block, iv)
+	buf := make([]byte, chunkSize)
+
+	for {
+		n, err := io.ReadFull(reader, buf)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("reading data: %w", err)
+		}
+
+		last := err != nil
+
+		chunk := buf[:n]
+		if last {
+			padding := aes.BlockSize - n%aes.BlockSize
+			for range padding {
+				chunk = append(chunk, byte(padding))
+			}
+		}
+
+		mode.CryptBlocks(chunk, chunk)
+
+		if _, err := output.Write(chunk); err != nil {
+			return fmt.Errorf("writing encrypted data: %w", err)
+		}
+
+		if last {
+			break
+		}
+	}
+
+	if encoder != nil {
+		if err := encoder.Close(); err != nil {
+			return fmt.Errorf("finishing base64: %w", err)
+		}
+
+		if _, err := io.WriteString(writer, "\n"); err != nil {
+			return fmt.Errorf("writing encrypted data: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// decryptOpenSSL decrypts the output of `openssl enc -aes-256-cbc -pbkdf2 -salt`, binary or base64,
+// from reader to writer, using the configured iteration count and digest.
+// CBC is not authenticated: a wrong password or digest is only detected by invalid padding,
+// and not reliably so.
+func (e *Encryptor) decryptOpenSSL(reader *bufio.Reader, writer io.Writer) error {
+	var input io.Reader = reader
+	if hasPrefix(reader, opensslBase64Magic) {
+		input = base64.NewDecoder(base64.StdEncoding, &newlineSkipper{reader: reader})
+	}
+
+	header := make([]byte, len(opensslMagic)+opensslSaltSize)
+	if _, err := io.ReadFull(input, header); err != nil {
+		return fmt.Errorf("%w: reading header: %w", ErrProcessing, err)
+	}
+
+	block, iv, err := e.opensslCipher(header[len(opensslMagic):])
+	if err != nil {
+		return err
+	}
+
+	mode := cipher.NewCBCDecrypter(block, iv)
+
+	// The last block holds the padding, so it is held back until the end of the input.
+	buffered := bufio.NewReaderSize(input, chunkSize+aes.BlockSize)
+	buf := make([]byte, chunkSize)
+
+	for {
+		n, err := io.ReadFull(buffered, buf)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("%w: reading encrypted data: %w", ErrProcessing, err)
+		}
+
+		if n%aes.BlockSize != 0 {
+			return fmt.Errorf("%w: ciphertext is not a multiple of the block size", ErrProcessing)
+		}
+
+		_, peekErr := buffered.Peek(1)
+		last := err != nil || peekErr != nil
+
+		chunk := buf[:n]
+		mode.CryptBlocks(chunk, chunk)
+
+		if last {
+			padding := 0
+			if n > 0 {
+				padding = int(chunk[n-1])
+			}
+
+			if padding == 0 || padding > aes.BlockSize || padding > n {
+				return fmt.Errorf("%w: bad decrypt: wrong password, digest or iteration count", ErrAuthentication)
+			}
+
+			for _, b := range chunk[n-padding:] {
+				if int(b) != padding {
+					return fmt.Errorf("%w: bad decrypt: wrong password, digest or iteration count", ErrAuthentication)
+				}
+			}
+
+			chunk = chunk[:n-padding]
+		}
+
+		if _, err := writer.Write(chunk); err != nil {
+			return fmt.Errorf("writing decrypted data: %w", err)
+		}
+
+		if last {
+			return nil
+		}
+	}
+}
+
+// lineWriter inserts a newline after every width bytes written.
+type lineWriter struct {
+	writer io.Writer
+	width  int
+	column int
+}
+
+// Write writes p, breaking it into lines.
+func (w *lineWriter) Write(p []byte) (int, error) {
+	written := 0
+
+	for len(p) > 0 {
+		if w.column == w.width {
+			if _, err := w.writer.Write([]byte("\n")); err != nil {
+				return written, err //nolint: wrapcheck
+			}
+
+			w.column = 0
+		}
+
+		n := min(len(p), w.width-w.column)
+
+		if _, err := w.writer.Write(p[:n]); err != nil {
+			return written, err //nolint: wrapcheck
+		}
+
+		written += n
+		w.column += n
+		p = p[n:]
+	}
+
+	return written, nil
+}
+
+// newlineSkipper drops line breaks from the reader, for decoding wrapped base64.
+type newlineSkipper struct {
+	reader io.Reader
+}
+
+// Read reads into p, without line breaks.
+func (r *newlineSkipper) Read(p []byte) (int, error) {
+	for {
+		n, err := r.reader.Read(p)
+
+		kept := 0
+
+		for _, b := range p[:n] {
+			if b != '\n' && b != '\r' {
+				p[kept] = b
+				kept++
+			}
+		}
+
+		if kept > 0 || err != nil {
+			return kept, err //nolint: wrapcheck
+		}
+	}
+}
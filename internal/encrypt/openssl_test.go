@@ -0,0 +1,138 @@
+package encrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestOpenSSLVectors decrypts the output of OpenSSL 3.0 `openssl enc -aes-256-cbc -pbkdf2 -pass pass:openssl`.
+func TestOpenSSLVectors(t *testing.T) {
+	t.Parallel()
+
+	binary, err := base64.StdEncoding.DecodeString("U2FsdGVkX18tCwqJG31D65Fm9YWbq50M5CaHqB9ej//pZuA5Eu1G1U4bzt0wRKxs")
+	if err != nil {
+		t.Fatalf("decoding vector: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		input      string
+		iterations int
+		digest     Digest
+		want       string
+	}{
+		{
+			name:  "binary",
+			input: string(binary),
+			want:  "password: hunter2\n",
+		},
+		{
+			name:  "base64",
+			input: "U2FsdGVkX18g5hZsEN2+149KLwEcAy12VXFC1dc5AhFP8dp0MGqmdMqFIdNa+u6c\n",
+			want:  "password: hunter2\n",
+		},
+		{
+			name:       "-iter 1000 -md sha512",
+			input:      "U2FsdGVkX1/VkSzT4Mu68ZVs25HshUeyfVr5CR8/gB5dEWNjvMjvyT1BuW3Qf2tm\n",
+			iterations: 1000,
+			digest:     SHA512,
+			want:       "password: hunter2\n",
+		},
+		{
+			name: "base64 lines",
+			input: "U2FsdGVkX18CA9LG4mMSYXNjgeUIeaQE/qUVRVPZx59ysw6hP+IgQtXfk2pfVUnL\n" +
+				"BAplxHEg0FNfXemV+634BtYcd7a/CNYHOAR2WDtB7QqYxg/iL5ms1DeLKoVLjsGO\n" +
+				"4UXBT7fLODNK91DEYsGrJi4/c4/sQpym7kNVWjXKRYw=\n",
+			want: strings.Repeat("x", 100),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			decrypted, err := processData(&Encryptor{
+				Operation:  Decrypt,
+				Iterations: test.iterations,
+				Digest:     test.digest,
+				Identities: []Identity{NewPassphrase([]byte("openssl"), KDFArgon2id)},
+			}, []byte(test.input))
+
+			switch {
+			case err != nil:
+				t.Fatalf("decrypting: %v", err)
+			case string(decrypted) != test.want:
+				t.Fatalf("decrypted %q, want %q", decrypted, test.want)
+			}
+		})
+	}
+}
+
+// TestOpenSSLDecrypt has the openssl CLI decrypt the output of gocry, binary and base64.
+func TestOpenSSLDecrypt(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("openssl is not installed")
+	}
+
+	plaintext := bytes.Repeat([]byte("password: hunter2\n"), 500)
+
+	tests := []struct {
+		name       string
+		armor      bool
+		iterations int
+		digest     Digest
+	}{
+		{name: "binary"},
+		{name: "base64", armor: true},
+		{name: "-iter 1000 -md sha512", armor: true, iterations: 1000, digest: SHA512},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			encrypted, err := processData(&Encryptor{
+				Operation:  Encrypt,
+				Format:     OpenSSL,
+				Armor:      test.armor,
+				Iterations: test.iterations,
+				Digest:     test.digest,
+				Identities: []Identity{NewPassphrase([]byte("openssl"), KDFArgon2id)},
+			}, plaintext)
+			if err != nil {
+				t.Fatalf("encrypting: %v", err)
+			}
+
+			args := []string{"enc", "-d", "-aes-256-cbc", "-pbkdf2", "-pass", "pass:openssl"}
+			if test.armor {
+				args = append(args, "-a")
+			}
+
+			if test.iterations != 0 {
+				args = append(args, "-iter", strconv.Itoa(test.iterations))
+			}
+
+			if test.digest != "" {
+				args = append(args, "-md", string(test.digest))
+			}
+
+			cmd := exec.Command("openssl", args...)
+			cmd.Stdin = bytes.NewReader(encrypted)
+
+			decrypted, err := cmd.Output()
+
+			switch {
+			case err != nil:
+				t.Fatalf("decrypting with openssl: %v", err)
+			case !bytes.Equal(decrypted, plaintext):
+				t.Fatalf("openssl decrypted %d bytes, want the %d bytes of plaintext", len(decrypted), len(plaintext))
+			}
+		})
+	}
+}
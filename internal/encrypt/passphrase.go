@@ -0,0 +1,108 @@
+package encrypt
+
+import (
+	"sync"
+)
+
+// Passphrase derives keys from a passphrase with a per-ciphertext salt, acting as both Recipient and Identity.
+// As passphrase-based derivation is deliberately slow, the salt is generated once per Passphrase
+// and derived keys are cached, so that encrypting or decrypting many lines derives only once.
+type Passphrase struct {
+	passphrase []byte
+	kdf        KDF
+
+	// mu guards the fields below, shared between parallel workers
+	mu sync.Mutex
+
+	// sealing holds the salt and cost used for wrapping
+	sealing *KDFParams
+
+	// derived caches derived keys by encoded salt and cost
+	derived map[string][]byte
+}
+
+// NewPassphrase creates a passphrase that derives keys with the given function when wrapping.
+func NewPassphrase(passphrase []byte, kdf KDF) *Passphrase {
+	return &Passphrase{passphrase: passphrase, kdf: kdf}
+}
+
+// String describes the passphrase without revealing it.
+func (p *Passphrase) String() string {
+	return "passphrase"
+}
+
+// Wrap wraps the data key with a key derived from the passphrase, recording the salt and cost.
+func (p *Passphrase) Wrap(dataKey []byte) (*Stanza, error) {
+	p.mu.Lock()
+
+	if p.sealing == nil {
+		params, err := newKDFParams(p.kdf)
+		if err != nil {
+			p.mu.Unlock()
+
+			return nil, err
+		}
+
+		p.sealing = &params
+	}
+
+	params := *p.sealing
+
+	p.mu.Unlock()
+
+	key, err := p.derive(p.kdf, params)
+	if err != nil {
+		return nil, err
+	}
+
+	stanza := &Stanza{Type: StanzaPassphrase, Args: encodeKDF(p.kdf, params)}
+
+	return stanza, sealDataKey(key, stanza, dataKey)
+}
+
+// Unwrap unwraps data keys wrapped with the same passphrase.
+func (p *Passphrase) Unwrap(stanza *Stanza) ([]byte, error) {
+	if stanza.Type != StanzaPassphrase {
+		return nil, errNotRecipient
+	}
+
+	kdf, params, err := decodeKDF(stanza.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	if kdf == KDFNone {
+		return nil, errNotRecipient
+	}
+
+	key, err := p.derive(kdf, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return openDataKey(key, stanza)
+}
+
+// derive derives the key from the passphrase, caching the result per salt and cost.
+func (p *Passphrase) derive(kdf KDF, params KDFParams) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	id := string(encodeKDF(kdf, params))
+	if key, ok := p.derived[id]; ok {
+		return key, nil
+	}
+
+	key, err := deriveFromPassphrase(kdf, params, p.passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.derived == nil {
+		p.derived = make(map[string][]byte)
+	}
+
+	p.derived[id] = key
+
+	return key, nil
+}
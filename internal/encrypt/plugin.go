@@ -0,0 +1,64 @@
+package encrypt
+
+import (
+	"fmt"
+)
+
+// StanzaPlugin holds the data key wrapped by a key provider plugin, such as with a key management service.
+// Its arguments are the provider, as name:argument, and its body is the wrapped key as returned by the plugin.
+const StanzaPlugin StanzaType = 4
+
+// KeyWrapper wraps and unwraps data keys on behalf of gocry, as key provider plugins do.
+type KeyWrapper interface {
+	// WrapKey returns the data key wrapped, in a form only the wrapper can unwrap
+	WrapKey(dataKey []byte) ([]byte, error)
+
+	// UnwrapKey returns the data key of a key wrapped by WrapKey
+	UnwrapKey(wrappedKey []byte) ([]byte, error)
+}
+
+// PluginKey is a key held by a key provider plugin, which never leaves it,
+// acting as both Recipient and Identity.
+type PluginKey struct {
+	provider string
+	wrapper  KeyWrapper
+}
+
+// NewPluginKey creates a key held by the provider, given as name:argument, which wraps data keys with wrapper.
+func NewPluginKey(provider string, wrapper KeyWrapper) *PluginKey {
+	return &PluginKey{provider: provider, wrapper: wrapper}
+}
+
+// String describes the key by its provider.
+func (k *PluginKey) String() string {
+	return "key provider " + k.provider
+}
+
+// Wrap has the plugin wrap the data key, recording the provider.
+func (k *PluginKey) Wrap(dataKey []byte) (*Stanza, error) {
+	wrapped, err := k.wrapper.WrapKey(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Stanza{Type: StanzaPlugin, Args: []byte(k.provider), Body: wrapped}, nil
+}
+
+// Unwrap has the plugin unwrap data keys wrapped by the same provider.
+func (k *PluginKey) Unwrap(stanza *Stanza) ([]byte, error) {
+	if stanza.Type != StanzaPlugin || string(stanza.Args) != k.provider {
+		return nil, errNotRecipient
+	}
+
+	dataKey, err := k.wrapper.UnwrapKey(stanza.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(dataKey) != dataKeySize {
+		return nil, fmt.Errorf("%w: %s unwrapped a data key of %d bytes, want %d",
+			ErrAuthentication, k, len(dataKey), dataKeySize)
+	}
+
+	return dataKey, nil
+}
@@ -9,8 +9,18 @@ import (
 	"sync"
 )
 
-// ErrProcessing indicates an error during processing.
-var ErrProcessing = errors.New("processing error")
+var (
+	// ErrProcessing indicates an error during processing.
+	ErrProcessing = errors.New("processing error")
+
+	// ErrAuthentication indicates that ciphertext failed authentication,
+	// either because it was tampered with or because the wrong key was supplied.
+	ErrAuthentication = errors.New("authentication failed")
+
+	// ErrWrongKey indicates that the ciphertext was encrypted with a different key
+	// than the one supplied, as detected from the key fingerprint in the header.
+	ErrWrongKey = errors.New("wrong key")
+)
 
 // processLines processes each line of the input data in parallel when possible.
 // It maintains the original line order in the output while leveraging parallel processing.
@@ -139,7 +149,18 @@ func (e *Encryptor) processLines(reader io.Reader, writer io.Writer, parallel in
 func (e *Encryptor) processWholeFile(reader io.Reader, writer io.Writer) (bool, error) {
 	switch e.Operation {
 	case Encrypt:
-		return true, e.encryptStream(reader, writer)
+		switch e.Format {
+		case Age:
+			return true, e.encryptAge(reader, writer)
+		case AnsibleVault:
+			return true, e.encryptVaultFile(reader, writer)
+		case OpenSSL:
+			return true, e.encryptOpenSSL(reader, writer)
+		case JWE:
+			return true, e.encryptJWEFile(reader, writer)
+		default:
+			return true, e.encryptStream(reader, writer)
+		}
 	case Decrypt:
 		return true, e.decryptStream(reader, writer)
 	default:
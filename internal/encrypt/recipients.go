@@ -0,0 +1,236 @@
+package encrypt
+
+import (
+	"crypto/hmac"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// dataKeySize is the size of the random data key generated for each encryption.
+const dataKeySize = 32
+
+// StanzaType identifies the kind of recipient a data key was wrapped for.
+type StanzaType byte
+
+const (
+	// StanzaKey holds the data key wrapped with a symmetric key.
+	// Its arguments are the fingerprint of the key.
+	StanzaKey StanzaType = 1
+
+	// StanzaPassphrase holds the data key wrapped with a key derived from a passphrase.
+	// Its arguments are the key derivation function, salt and cost, as encoded by encodeKDF.
+	StanzaPassphrase StanzaType = 2
+)
+
+// Stanza holds the data key wrapped for a single recipient, as stored in the header.
+type Stanza struct {
+	// Type identifies the kind of recipient
+	Type StanzaType
+
+	// Args holds the public parameters needed to unwrap the data key
+	Args []byte
+
+	// Body holds the wrapped data key
+	Body []byte
+}
+
+// marshal encodes the stanza as [1 byte type][2 bytes big-endian arguments length][arguments][body].
+func (s *Stanza) marshal() []byte {
+	value := []byte{byte(s.Type)}
+	value = binary.BigEndian.AppendUint16(value, uint16(len(s.Args)))
+	value = append(value, s.Args...)
+
+	return append(value, s.Body...)
+}
+
+// unmarshalStanza decodes a stanza encoded by marshal.
+func unmarshalStanza(value []byte) (*Stanza, error) {
+	const prefixSize = 3
+
+	if len(value) < prefixSize {
+		return nil, fmt.Errorf("%w: stanza too short", ErrHeader)
+	}
+
+	length := int(binary.BigEndian.Uint16(value[1:prefixSize]))
+	if len(value) < prefixSize+length {
+		return nil, fmt.Errorf("%w: stanza arguments too long", ErrHeader)
+	}
+
+	return &Stanza{
+		Type: StanzaType(value[0]),
+		Args: value[prefixSize : prefixSize+length],
+		Body: value[prefixSize+length:],
+	}, nil
+}
+
+// String describes the recipient the stanza was wrapped for.
+func (s *Stanza) String() string {
+	switch s.Type {
+	case StanzaKey:
+		return "key " + hex.EncodeToString(s.Args)
+	case StanzaPassphrase:
+		kdf, _, _ := decodeKDF(s.Args)
+
+		return fmt.Sprintf("passphrase (%s)", kdf)
+	case StanzaX25519:
+		return "an X25519 recipient"
+	case StanzaPlugin:
+		return "key provider " + string(s.Args)
+	default:
+		return fmt.Sprintf("unknown recipient type %d", s.Type)
+	}
+}
+
+// Recipient wraps data keys, so that only the holder of a matching Identity can unwrap them.
+type Recipient interface {
+	// Wrap returns the data key wrapped for the recipient
+	Wrap(dataKey []byte) (*Stanza, error)
+}
+
+// Identity unwraps data keys that were wrapped for it.
+type Identity interface {
+	// Unwrap returns the data key wrapped in the stanza, or errNotRecipient if it was not wrapped for the identity
+	Unwrap(stanza *Stanza) ([]byte, error)
+
+	// String describes the identity in error messages
+	String() string
+}
+
+// errNotRecipient is returned by Identity.Unwrap for stanzas that were wrapped for someone else.
+var errNotRecipient = errors.New("not a recipient")
+
+// sealDataKey wraps the data key into the stanza with AES-SIV under a subkey of key,
+// authenticating the stanza type and arguments.
+// AES-SIV is deterministic, which keeps the header identical for Deterministic encryption.
+func sealDataKey(key []byte, stanza *Stanza, dataKey []byte) error {
+	aead, err := wrapAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	stanza.Body = aead.Seal(nil, nil, dataKey, append([]byte{byte(stanza.Type)}, stanza.Args...))
+
+	return nil
+}
+
+// openDataKey unwraps the data key from the stanza, as sealed by sealDataKey.
+// It returns errNotRecipient if the key does not authenticate the stanza.
+func openDataKey(key []byte, stanza *Stanza) ([]byte, error) {
+	aead, err := wrapAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := aead.Open(nil, nil, stanza.Body, append([]byte{byte(stanza.Type)}, stanza.Args...))
+	if err != nil || len(dataKey) != dataKeySize {
+		return nil, errNotRecipient
+	}
+
+	return dataKey, nil
+}
+
+// KeySize is the size of symmetric keys.
+const KeySize = aesKeySize
+
+// SymmetricKey is a 32 bytes key, acting as both Recipient and Identity.
+type SymmetricKey struct {
+	key  []byte
+	name string
+}
+
+// NewSymmetricKey creates a symmetric key from its raw bytes.
+func NewSymmetricKey(key []byte) (*SymmetricKey, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("invalid key length: got %d bytes, want %d", len(key), KeySize) //nolint: err113
+	}
+
+	return &SymmetricKey{key: key}, nil
+}
+
+// Fingerprint returns the fingerprint of the key.
+func (k *SymmetricKey) Fingerprint() string {
+	return Fingerprint(k.key)
+}
+
+// SetName names the key, e.g. after its keyring entry, for use in messages.
+func (k *SymmetricKey) SetName(name string) {
+	k.name = name
+}
+
+// String describes the key by its fingerprint, and its name if set.
+func (k *SymmetricKey) String() string {
+	if k.name != "" {
+		return fmt.Sprintf("key %s (%s)", k.name, k.Fingerprint())
+	}
+
+	return "key " + k.Fingerprint()
+}
+
+// Wrap wraps the data key with a subkey of the key, recording the key fingerprint.
+func (k *SymmetricKey) Wrap(dataKey []byte) (*Stanza, error) {
+	stanza := &Stanza{Type: StanzaKey, Args: keyID(k.key)}
+
+	return stanza, sealDataKey(k.key, stanza, dataKey)
+}
+
+// Unwrap unwraps data keys wrapped for a key with the same fingerprint.
+func (k *SymmetricKey) Unwrap(stanza *Stanza) ([]byte, error) {
+	if stanza.Type != StanzaKey || !hmac.Equal(stanza.Args, keyID(k.key)) {
+		return nil, errNotRecipient
+	}
+
+	dataKey, err := openDataKey(k.key, stanza)
+	if err != nil {
+		return nil, fmt.Errorf("%w: tampered key stanza", ErrAuthentication)
+	}
+
+	return dataKey, nil
+}
+
+// deterministicDataKey derives the data key for Deterministic encryption from the key and the context,
+// in place of a random one.
+func (k *SymmetricKey) deterministicDataKey(context []byte) ([]byte, error) {
+	return deriveKey(k.key, infoDeterministic+string(context), dataKeySize)
+}
+
+// wrongKeyError reports that none of the identities could unwrap any of the stanzas.
+func wrongKeyError(stanzas []*Stanza, identities []Identity) error {
+	supplied := make([]string, 0, len(identities))
+	for _, identity := range identities {
+		supplied = append(supplied, identity.String())
+	}
+
+	return fmt.Errorf("%w: encrypted with %s, you supplied %s",
+		ErrWrongKey, describeStanzas(stanzas), strings.Join(supplied, ", "))
+}
+
+// describeStanzas lists the recipients the stanzas were wrapped for, as used in messages.
+func describeStanzas(stanzas []*Stanza) string {
+	recipients := make([]string, 0, len(stanzas))
+	for _, stanza := range stanzas {
+		recipients = append(recipients, stanza.String())
+	}
+
+	return strings.Join(recipients, ", ")
+}
+
+// rawKeys returns the symmetric keys for formats keyed by a raw key, such as JWE and Fernet.
+// They are used as is, without binding to the context, so that other implementations of the format can use them.
+func (e *Encryptor) rawKeys(format Format) ([][]byte, error) {
+	var keys [][]byte
+
+	for _, identity := range e.Identities {
+		if key, ok := identity.(*SymmetricKey); ok {
+			keys = append(keys, key.key)
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: the %s format requires a key", ErrWrongKey, format)
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,396 @@
+package encrypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+var (
+	// ErrRewrap indicates ciphertext whose data key cannot be rewrapped, and which has to be re-encrypted instead.
+	ErrRewrap = errors.New("cannot rewrap")
+
+	// ErrRecipients indicates ciphertext that cannot be re-encrypted without dropping other recipients.
+	ErrRecipients = errors.New("cannot re-encrypt for other recipients")
+)
+
+// Rewrap rotates file-mode ciphertext read from reader to the recipients of to, without re-encrypting the payload:
+// the data key is unwrapped with e, wrapped for the recipients of to in a new header, and the payload copied as is.
+// Only the stanzas wrapped for the identities of e (or already for those of to) are replaced,
+// those of other recipients are copied unchanged.
+// It fails with ErrRewrap before writing anything for ciphertext without a wrapped data key,
+// as written by earlier versions, and for deterministic ciphertext, whose data key is derived from the key.
+//
+// Rewrapping does not help against holders of the old key who already obtained the data key;
+// re-encrypt the ciphertext if the old key is compromised.
+func (e *Encryptor) Rewrap(reader io.Reader, writer io.Writer, to *Encryptor) error {
+	buffered := bufio.NewReader(reader)
+
+	if !hasMagic(buffered) {
+		return fmt.Errorf("%w: not file-mode ciphertext", ErrRewrap)
+	}
+
+	if version, _ := buffered.Peek(len(magic) + 1); version[len(magic)] < headerVersion {
+		return fmt.Errorf("%w: written by an earlier version", ErrRewrap)
+	}
+
+	header, raw, err := readHeader(buffered)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrProcessing, err)
+	}
+
+	switch {
+	case len(header.Stanzas) == 0:
+		return fmt.Errorf("%w: no wrapped data key", ErrRewrap)
+	case header.Suite == AES256SIV:
+		return fmt.Errorf("%w: deterministic ciphertext", ErrRewrap)
+	}
+
+	mac := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(buffered, mac); err != nil {
+		return fmt.Errorf("%w: reading header MAC: %w", ErrProcessing, err)
+	}
+
+	dataKey, err := e.unwrap(header.Stanzas)
+	if err != nil {
+		return err
+	}
+
+	key, err := contextKey(dataKey, header.Context)
+	if err != nil {
+		return err
+	}
+
+	expected, err := headerMAC(key, raw)
+	if err != nil {
+		return err
+	}
+
+	if !hmac.Equal(mac, expected) {
+		return fmt.Errorf("%w: wrong key or tampered header", ErrAuthentication)
+	}
+
+	stanzas, err := e.rewrapStanzas(header.Stanzas, dataKey, to)
+	if err != nil {
+		return err
+	}
+
+	rewrapped := &Header{Suite: header.Suite, Context: header.Context, Stanzas: stanzas}
+
+	if raw, err = rewrapped.MarshalBinary(); err != nil {
+		return err
+	}
+
+	if mac, err = headerMAC(key, raw); err != nil {
+		return err
+	}
+
+	for _, part := range [][]byte{raw, mac} {
+		if _, err := writer.Write(part); err != nil {
+			return fmt.Errorf("writing header: %w", err)
+		}
+	}
+
+	// The nonce prefix and the chunks only depend on the data key, and are copied unchanged.
+	if _, err := io.Copy(writer, buffered); err != nil {
+		return fmt.Errorf("copying payload: %w", err)
+	}
+
+	return nil
+}
+
+// Reencrypt re-encrypts the file-mode ciphertext read from reader, decrypting it with e and encrypting it with to.
+// Ciphertext with a header is re-encrypted with the cipher suite and context recorded in it,
+// regardless of the type, cipher and context of to,
+// and a JWE file stays a JWE file, with the same key management algorithm.
+// Legacy ciphertext is re-encrypted in the current format.
+// It fails with ErrRecipients for ciphertext also wrapped for other recipients,
+// as they cannot be given the new data key. The plaintext is held in memory.
+func (e *Encryptor) Reencrypt(reader io.Reader, writer io.Writer, to *Encryptor) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("%w: reading error: %w", ErrProcessing, err)
+	}
+
+	if isJWE(bufio.NewReader(bytes.NewReader(data))) {
+		return e.reencryptJWE(bytes.TrimSpace(data), writer, to)
+	}
+
+	if header, _, err := readHeader(bytes.NewReader(data)); err == nil {
+		if others := e.otherStanzas(header.Stanzas, to); len(others) > 0 {
+			return fmt.Errorf("%w: also encrypted for %s, who would lose access", ErrRecipients, describeStanzas(others))
+		}
+
+		to = to.forHeader(header)
+	}
+
+	var plaintext bytes.Buffer
+
+	if err := e.decryptStream(bytes.NewReader(data), &plaintext); err != nil {
+		return err
+	}
+
+	return to.encryptStream(&plaintext, writer)
+}
+
+// RekeyLines re-encrypts the encrypted lines read from reader, decrypting them with e and encrypting them with to,
+// in the same line format (gocry, JWE or Fernet), cipher suite and context they were in.
+// Gocry lines also wrapped for other recipients keep their data key, which is rewrapped as by Rewrap,
+// and are sealed again under the new header.
+// Lines that already decrypt with the identities of to, as after an interrupted run, are left as they are.
+// All other bytes are copied unchanged, including the line terminators (LF or CRLF) and a missing final newline.
+// It returns the number of lines re-encrypted, and the number of lines found already rotated.
+func (e *Encryptor) RekeyLines(reader io.Reader, writer io.Writer, to *Encryptor) (int, int, error) {
+	prefix := e.Directives.Decrypt + ": "
+	rekeyed, rotated := 0, 0
+
+	buffered := bufio.NewReader(reader)
+
+	for {
+		line, readErr := buffered.ReadString('\n')
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return rekeyed, rotated, fmt.Errorf("%w: reading error: %w", ErrProcessing, readErr)
+		}
+
+		body, terminator := splitLine(line)
+
+		if strings.HasPrefix(body, prefix) {
+			reencrypted, isRotated, err := e.rekeyLine([]byte(strings.TrimPrefix(body, prefix)), to)
+
+			switch {
+			case err != nil:
+				return rekeyed, rotated, err
+			case isRotated:
+				rotated++
+			default:
+				line = prefix + string(reencrypted) + terminator
+				rekeyed++
+			}
+		}
+
+		if _, err := io.WriteString(writer, line); err != nil {
+			return rekeyed, rotated, fmt.Errorf("%w: writing error: %w", ErrProcessing, err)
+		}
+
+		if readErr != nil {
+			return rekeyed, rotated, nil
+		}
+	}
+}
+
+// splitLine splits a line into its content and its terminator, which is CRLF, LF or empty for a final line.
+func splitLine(line string) (string, string) {
+	for _, terminator := range []string{"\r\n", "\n"} {
+		if body, ok := strings.CutSuffix(line, terminator); ok {
+			return body, terminator
+		}
+	}
+
+	return line, ""
+}
+
+// rekeyLine decrypts the ciphertext of a line with e and re-encrypts it with to, in the same format.
+// It reports whether the ciphertext cannot be decrypted with e but already decrypts with to,
+// in which case nothing is re-encrypted.
+func (e *Encryptor) rekeyLine(encrypted []byte, to *Encryptor) ([]byte, bool, error) {
+	// JWE and Fernet do not identify their key, so a wrong key shows as an authentication failure.
+	plaintext, err := e.decryptData(encrypted)
+	if errors.Is(err, ErrWrongKey) || errors.Is(err, ErrAuthentication) {
+		if _, rotatedErr := to.decryptData(encrypted); rotatedErr == nil {
+			return nil, true, nil
+		}
+	}
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	format := GoCry
+
+	switch {
+	case isJWECompact(encrypted):
+		format = JWE
+	case isFernet(encrypted):
+		format = Fernet
+	default:
+		if header := lineHeader(encrypted); header != nil {
+			if len(e.otherStanzas(header.Stanzas, to)) > 0 {
+				rewrapped, err := e.rewrapLine(header, plaintext, to)
+
+				return rewrapped, false, err
+			}
+
+			to = to.forHeader(header)
+		}
+	}
+
+	reencrypted, err := to.encryptDataAs(plaintext, format)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return reencrypted, false, nil
+}
+
+// lineHeader returns the header of gocry line ciphertext, or nil for other and legacy ciphertext.
+func lineHeader(encrypted []byte) *Header {
+	ciphertext, err := base64.StdEncoding.DecodeString(string(encrypted))
+	if err != nil {
+		return nil
+	}
+
+	header, _, err := readHeader(bytes.NewReader(ciphertext))
+	if err != nil {
+		return nil
+	}
+
+	return header
+}
+
+// rewrapLine rewraps the data key of gocry line ciphertext with the given header for the recipients of to,
+// and seals the plaintext again under the new header, with the same data key and cipher suite.
+func (e *Encryptor) rewrapLine(header *Header, plaintext []byte, to *Encryptor) ([]byte, error) {
+	dataKey, err := e.unwrap(header.Stanzas)
+	if err != nil {
+		return nil, err
+	}
+
+	stanzas, err := e.rewrapStanzas(header.Stanzas, dataKey, to)
+	if err != nil {
+		return nil, err
+	}
+
+	rewrapped := &Header{Suite: header.Suite, Context: header.Context, Stanzas: stanzas}
+
+	key, err := contextKey(dataKey, header.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := sealBytes(rewrapped, key, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(base64.StdEncoding.EncodeToString(ciphertext)), nil
+}
+
+// rewrapStanzas replaces the stanzas wrapped for the identities of e or to by the data key wrapped
+// for the recipients of to, in place of the first replaced one. The stanzas of other recipients are kept as they are.
+func (e *Encryptor) rewrapStanzas(stanzas []*Stanza, dataKey []byte, to *Encryptor) ([]*Stanza, error) {
+	if len(to.Recipients) == 0 {
+		return nil, fmt.Errorf("%w: no recipients to encrypt for", ErrProcessing)
+	}
+
+	wrapped := make([]*Stanza, 0, len(to.Recipients))
+
+	for _, recipient := range to.Recipients {
+		stanza, err := recipient.Wrap(dataKey)
+		if err != nil {
+			return nil, err
+		}
+
+		wrapped = append(wrapped, stanza)
+	}
+
+	others := e.otherStanzas(stanzas, to)
+	rewrapped := make([]*Stanza, 0, len(others)+len(wrapped))
+
+	for _, stanza := range stanzas {
+		switch {
+		case slices.Contains(others, stanza):
+			rewrapped = append(rewrapped, stanza)
+		case wrapped != nil:
+			rewrapped = append(rewrapped, wrapped...)
+			wrapped = nil
+		}
+	}
+
+	return append(rewrapped, wrapped...), nil
+}
+
+// otherStanzas returns the stanzas wrapped for none of the identities of e and to, i.e. for other recipients.
+func (e *Encryptor) otherStanzas(stanzas []*Stanza, to *Encryptor) []*Stanza {
+	var others []*Stanza
+
+	for _, stanza := range stanzas {
+		if !isWrappedFor(stanza, e.Identities) && !isWrappedFor(stanza, to.Identities) {
+			others = append(others, stanza)
+		}
+	}
+
+	return others
+}
+
+// isWrappedFor reports whether the stanza was wrapped for any of the identities.
+func isWrappedFor(stanza *Stanza, identities []Identity) bool {
+	for _, identity := range identities {
+		if _, err := identity.Unwrap(stanza); !errors.Is(err, errNotRecipient) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// forHeader returns an Encryptor encrypting like e, but with the cipher suite and context of the header,
+// so that re-encrypted ciphertext stays bound to the context it was encrypted with, wherever it is rekeyed from.
+// Headers predating contexts are re-encrypted with the context of e, as new ciphertext would be.
+// The Encryptors are cached, so that all lines re-encrypted with the same suite and context share a data key.
+func (e *Encryptor) forHeader(header *Header) *Encryptor {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	suite, context := header.Suite, e.Context
+	if header.Context != nil {
+		context = string(header.Context)
+	}
+
+	cached := reencryption{suite: suite, context: context}
+
+	if encryptor, ok := e.reencryptors[cached]; ok {
+		return encryptor
+	}
+
+	// Encryptor holds a mutex and per-run caches, so the configuration is copied field by field.
+	encryptor := &Encryptor{
+		Recipients:   e.Recipients,
+		Identities:   e.Identities,
+		Operation:    e.Operation,
+		Type:         Random,
+		Cipher:       AES,
+		Format:       e.Format,
+		Armor:        e.Armor,
+		Iterations:   e.Iterations,
+		Digest:       e.Digest,
+		JWEAlgorithm: e.JWEAlgorithm,
+		TTL:          e.TTL,
+		VaultID:      e.VaultID,
+		Mode:         e.Mode,
+		Directives:   e.Directives,
+		Context:      context,
+		Parallel:     e.Parallel,
+	}
+
+	switch suite {
+	case AES256SIV:
+		encryptor.Type = Deterministic
+	case XChaCha20Poly1305:
+		encryptor.Cipher = XChaCha20
+	}
+
+	if e.reencryptors == nil {
+		e.reencryptors = make(map[reencryption]*Encryptor)
+	}
+
+	e.reencryptors[cached] = encryptor
+
+	return encryptor
+}
@@ -0,0 +1,415 @@
+package encrypt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// keyEncryptor returns an Encryptor encrypting for and decrypting with the keys.
+func keyEncryptor(typ Type, cipher Cipher, keys ...*SymmetricKey) *Encryptor {
+	encryptor := &Encryptor{Type: typ, Cipher: cipher, Mode: File, Context: "rekey_test"}
+
+	for _, key := range keys {
+		encryptor.Recipients = append(encryptor.Recipients, key)
+		encryptor.Identities = append(encryptor.Identities, key)
+	}
+
+	return encryptor
+}
+
+// encryptTestStream encrypts plaintext into file-mode ciphertext for the keys.
+func encryptTestStream(t *testing.T, typ Type, cipher Cipher, plaintext []byte, keys ...*SymmetricKey) []byte {
+	t.Helper()
+
+	var ciphertext bytes.Buffer
+	if err := keyEncryptor(typ, cipher, keys...).encryptStream(bytes.NewReader(plaintext), &ciphertext); err != nil {
+		t.Fatalf("encryptStream: %v", err)
+	}
+
+	return ciphertext.Bytes()
+}
+
+// decryptTestStream decrypts file-mode ciphertext with the key.
+func decryptTestStream(ciphertext []byte, key *SymmetricKey) ([]byte, error) {
+	var plaintext bytes.Buffer
+
+	err := keyEncryptor(Random, AES, key).decryptStream(bytes.NewReader(ciphertext), &plaintext)
+
+	return plaintext.Bytes(), err
+}
+
+// splitHeader splits file-mode ciphertext into its parsed header and the payload following the header MAC.
+func splitHeader(t *testing.T, ciphertext []byte) (*Header, []byte) {
+	t.Helper()
+
+	header, raw, err := readHeader(bytes.NewReader(ciphertext))
+	if err != nil {
+		t.Fatalf("readHeader: %v", err)
+	}
+
+	return header, ciphertext[len(raw)+sha256.Size:]
+}
+
+// stanzaIndex returns the index of the stanza wrapped for the key, or -1.
+func stanzaIndex(header *Header, key *SymmetricKey) int {
+	for i, stanza := range header.Stanzas {
+		if isWrappedFor(stanza, []Identity{key}) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// TestRewrap rewraps file-mode ciphertext from an old to a new key, keeping the payload and other recipients.
+func TestRewrap(t *testing.T) {
+	t.Parallel()
+
+	oldKey, newKey, otherKey := testSymmetricKey(t, 1), testSymmetricKey(t, 2), testSymmetricKey(t, 3)
+
+	// Two chunks, the last one partial.
+	plaintext := bytes.Repeat([]byte("rewrap me "), (chunkSize+100)/10)
+
+	tests := []struct {
+		name   string
+		typ    Type
+		cipher Cipher
+		keys   []*SymmetricKey
+		err    error
+	}{
+		{name: "single recipient", typ: Random, cipher: AES, keys: []*SymmetricKey{oldKey}},
+		{name: "other recipients", typ: Random, cipher: AES, keys: []*SymmetricKey{otherKey, oldKey, testSymmetricKey(t, 4)}},
+		{name: "xchacha20-poly1305", typ: Random, cipher: XChaCha20, keys: []*SymmetricKey{oldKey}},
+		{name: "deterministic", typ: Deterministic, cipher: AES, keys: []*SymmetricKey{oldKey}, err: ErrRewrap},
+		{name: "already rotated", typ: Random, cipher: AES, keys: []*SymmetricKey{newKey}, err: ErrWrongKey},
+		{name: "other recipient only", typ: Random, cipher: AES, keys: []*SymmetricKey{otherKey}, err: ErrWrongKey},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			ciphertext := encryptTestStream(t, test.typ, test.cipher, plaintext, test.keys...)
+
+			var rewrapped bytes.Buffer
+
+			// The context of the target, as for a file rekeyed at another path, is ignored in favor of the header.
+			to := keyEncryptor(Random, AES, newKey)
+			to.Context = "moved/rekey_test"
+
+			err := keyEncryptor(Random, AES, oldKey).Rewrap(bytes.NewReader(ciphertext), &rewrapped, to)
+
+			switch {
+			case test.err != nil && !errors.Is(err, test.err):
+				t.Fatalf("Rewrap error = %v, want %v", err, test.err)
+			case test.err != nil && rewrapped.Len() > 0:
+				t.Fatalf("Rewrap wrote %d bytes before failing", rewrapped.Len())
+			case test.err != nil:
+				return
+			case err != nil:
+				t.Fatalf("Rewrap: %v", err)
+			}
+
+			before, payload := splitHeader(t, ciphertext)
+			after, rewrappedPayload := splitHeader(t, rewrapped.Bytes())
+
+			switch {
+			case !bytes.Equal(rewrappedPayload, payload):
+				t.Fatal("Rewrap changed the payload")
+			case after.Suite != before.Suite:
+				t.Fatalf("Rewrap changed the suite from %s to %s", before.Suite, after.Suite)
+			case !bytes.Equal(after.Context, before.Context):
+				t.Fatalf("Rewrap changed the context from %q to %q", before.Context, after.Context)
+			case len(after.Stanzas) != len(before.Stanzas):
+				t.Fatalf("Rewrap left %d stanzas, want %d", len(after.Stanzas), len(before.Stanzas))
+			case stanzaIndex(after, newKey) != stanzaIndex(before, oldKey):
+				t.Fatalf("new key wrapped at %d, want in place of the old key at %d", stanzaIndex(after, newKey), stanzaIndex(before, oldKey))
+			}
+
+			if _, err := decryptTestStream(rewrapped.Bytes(), oldKey); !errors.Is(err, ErrWrongKey) {
+				t.Fatalf("decrypting with the old key: error = %v, want %v", err, ErrWrongKey)
+			}
+
+			for _, key := range append([]*SymmetricKey{newKey}, test.keys...) {
+				if key == oldKey {
+					continue
+				}
+
+				if decrypted, err := decryptTestStream(rewrapped.Bytes(), key); err != nil || !bytes.Equal(decrypted, plaintext) {
+					t.Fatalf("decrypting with %s: %v, want the plaintext", key, err)
+				}
+			}
+		})
+	}
+}
+
+// TestReencrypt re-encrypts file-mode ciphertext from an old to a new key, keeping its cipher suite or format.
+func TestReencrypt(t *testing.T) {
+	t.Parallel()
+
+	oldKey, newKey, otherKey := testSymmetricKey(t, 1), testSymmetricKey(t, 2), testSymmetricKey(t, 3)
+	plaintext := []byte("password: hunter2\n")
+
+	jwe := func(algorithm JWEAlgorithm) []byte {
+		var token bytes.Buffer
+
+		encryptor := &Encryptor{Identities: []Identity{oldKey}, JWEAlgorithm: algorithm}
+		if err := encryptor.encryptJWEFile(bytes.NewReader(plaintext), &token); err != nil {
+			t.Fatalf("encryptJWEFile: %v", err)
+		}
+
+		return token.Bytes()
+	}
+
+	tests := []struct {
+		name       string
+		ciphertext []byte
+		suite      Suite
+		algorithm  JWEAlgorithm
+		err        error
+	}{
+		{name: "aes-256-gcm", ciphertext: encryptTestStream(t, Random, AES, plaintext, oldKey), suite: AES256GCM},
+		{name: "xchacha20-poly1305", ciphertext: encryptTestStream(t, Random, XChaCha20, plaintext, oldKey), suite: XChaCha20Poly1305},
+		{name: "deterministic", ciphertext: encryptTestStream(t, Deterministic, AES, plaintext, oldKey), suite: AES256SIV},
+		{name: "jwe dir", ciphertext: jwe(JWEDirect), algorithm: JWEDirect},
+		{name: "jwe A256KW", ciphertext: jwe(JWEA256KW), algorithm: JWEA256KW},
+		{name: "other recipients", ciphertext: encryptTestStream(t, Random, AES, plaintext, oldKey, otherKey), err: ErrRecipients},
+		{name: "already rotated", ciphertext: encryptTestStream(t, Random, AES, plaintext, newKey), err: ErrWrongKey},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var reencrypted bytes.Buffer
+
+			// The type, cipher and context of the target are ignored in favor of those of the source.
+			to := keyEncryptor(Random, AES, newKey)
+			to.Context = "moved/rekey_test"
+
+			err := keyEncryptor(Random, AES, oldKey).Reencrypt(bytes.NewReader(test.ciphertext), &reencrypted, to)
+
+			switch {
+			case test.err != nil && !errors.Is(err, test.err):
+				t.Fatalf("Reencrypt error = %v, want %v", err, test.err)
+			case test.err != nil:
+				return
+			case err != nil:
+				t.Fatalf("Reencrypt: %v", err)
+			}
+
+			var decrypted bytes.Buffer
+
+			if err := keyEncryptor(Random, AES, newKey).decryptStream(bytes.NewReader(reencrypted.Bytes()), &decrypted); err != nil {
+				t.Fatalf("decrypting with the new key: %v", err)
+			}
+
+			if !bytes.Equal(decrypted.Bytes(), plaintext) {
+				t.Fatalf("decrypted %q, want %q", decrypted.Bytes(), plaintext)
+			}
+
+			if test.algorithm != "" {
+				token := bytes.TrimSpace(reencrypted.Bytes())
+				if !isJWECompact(token) || !bytes.HasSuffix(reencrypted.Bytes(), []byte("\n")) {
+					t.Fatalf("Reencrypt wrote %q, want a JWE file", reencrypted.Bytes())
+				}
+
+				if _, err := keyEncryptor(Random, AES, oldKey).decryptJWE(token); !errors.Is(err, ErrAuthentication) {
+					t.Fatalf("decrypting with the old key: error = %v, want %v", err, ErrAuthentication)
+				}
+
+				if algorithm := jweAlgorithm(t, token); algorithm != test.algorithm {
+					t.Fatalf("Reencrypt changed the algorithm from %s to %s", test.algorithm, algorithm)
+				}
+
+				return
+			}
+
+			header, _ := splitHeader(t, reencrypted.Bytes())
+
+			switch {
+			case header.Suite != test.suite:
+				t.Fatalf("Reencrypt changed the suite from %s to %s", test.suite, header.Suite)
+			case string(header.Context) != "rekey_test":
+				t.Fatalf("Reencrypt changed the context to %q, want %q", header.Context, "rekey_test")
+			case test.suite == AES256SIV && !bytes.Equal(reencrypted.Bytes(), encryptTestStream(t, Deterministic, AES, plaintext, newKey)):
+				t.Fatal("Reencrypt wrote deterministic ciphertext other than encrypting with the new key")
+			}
+
+			if _, err := decryptTestStream(reencrypted.Bytes(), oldKey); !errors.Is(err, ErrWrongKey) {
+				t.Fatalf("decrypting with the old key: error = %v, want %v", err, ErrWrongKey)
+			}
+		})
+	}
+}
+
+// TestRekeyLines re-encrypts encrypted lines from an old to a new key, keeping everything else as it is.
+func TestRekeyLines(t *testing.T) {
+	t.Parallel()
+
+	oldKey, newKey, otherKey := testSymmetricKey(t, 1), testSymmetricKey(t, 2), testSymmetricKey(t, 3)
+	prefix := "### DIRECTIVE: DECRYPT: "
+
+	// line encrypts the plaintext for the keys as an encrypted line, in the format and with the cipher.
+	line := func(plaintext string, format Format, cipher Cipher, keys ...*SymmetricKey) string {
+		encrypted, err := keyEncryptor(Random, cipher, keys...).encryptDataAs([]byte(plaintext), format)
+		if err != nil {
+			t.Fatalf("encryptDataAs: %v", err)
+		}
+
+		return prefix + string(encrypted)
+	}
+
+	tests := []struct {
+		name    string
+		lines   []string
+		rekeyed int
+		rotated int
+	}{
+		{
+			name: "lf",
+			lines: []string{
+				"plain\n",
+				line("gcm", GoCry, AES, oldKey) + "\n",
+				line("xchacha", GoCry, XChaCha20, oldKey) + "\n",
+			},
+			rekeyed: 2,
+		},
+		{
+			name: "crlf and no final newline",
+			lines: []string{
+				"plain\r\n",
+				line("jwe", JWE, AES, oldKey) + "\r\n",
+				"\r\n",
+				line("fernet", Fernet, AES, oldKey),
+			},
+			rekeyed: 2,
+		},
+		{
+			name: "other recipients",
+			lines: []string{
+				line("shared", GoCry, XChaCha20, otherKey, oldKey) + "\n",
+			},
+			rekeyed: 1,
+		},
+		{
+			name: "already rotated",
+			lines: []string{
+				line("gcm", GoCry, AES, newKey) + "\n",
+				line("jwe", JWE, AES, newKey) + "\r\n",
+				line("fernet", Fernet, AES, newKey) + "\n",
+			},
+			rotated: 3,
+		},
+		{
+			name: "partly rotated",
+			lines: []string{
+				line("rotated", GoCry, AES, newKey) + "\n",
+				line("pending", GoCry, AES, oldKey) + "\n",
+			},
+			rekeyed: 1,
+			rotated: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			input := strings.Join(test.lines, "")
+			decryptor := keyEncryptor(Random, AES, oldKey)
+			decryptor.Directives.Decrypt = strings.TrimSuffix(prefix, ": ")
+
+			var output bytes.Buffer
+
+			to := keyEncryptor(Random, AES, newKey)
+			to.Context = "moved/rekey_test"
+
+			rekeyed, rotated, err := decryptor.RekeyLines(strings.NewReader(input), &output, to)
+
+			switch {
+			case err != nil:
+				t.Fatalf("RekeyLines: %v", err)
+			case rekeyed != test.rekeyed || rotated != test.rotated:
+				t.Fatalf("RekeyLines = %d rekeyed, %d rotated, want %d, %d", rekeyed, rotated, test.rekeyed, test.rotated)
+			case test.rekeyed == 0 && output.String() != input:
+				t.Fatalf("RekeyLines changed rotated lines to %q", output.String())
+			}
+
+			lines := strings.SplitAfter(output.String(), "\n")
+			if lines[len(lines)-1] == "" {
+				lines = lines[:len(lines)-1]
+			}
+			if len(lines) != len(test.lines) {
+				t.Fatalf("RekeyLines wrote %d lines, want %d", len(lines), len(test.lines))
+			}
+
+			for i, got := range lines {
+				body, terminator := splitLine(got)
+				wantBody, wantTerminator := splitLine(test.lines[i])
+
+				if terminator != wantTerminator {
+					t.Fatalf("line %d ends with %q, want %q", i, terminator, wantTerminator)
+				}
+
+				encrypted, ok := strings.CutPrefix(body, prefix)
+				if !ok {
+					if body != wantBody {
+						t.Fatalf("line %d changed to %q, want %q", i, body, wantBody)
+					}
+
+					continue
+				}
+
+				checkRekeyedLine(t, []byte(encrypted), []byte(strings.TrimPrefix(wantBody, prefix)), oldKey, newKey, otherKey)
+			}
+		})
+	}
+}
+
+// checkRekeyedLine checks that the rekeyed line ciphertext decrypts with the new key to the plaintext of the original,
+// in the same format, cipher suite and context, and that other recipients of the original can still decrypt it.
+func checkRekeyedLine(t *testing.T, rekeyed, original []byte, oldKey, newKey, otherKey *SymmetricKey) {
+	t.Helper()
+
+	plaintext, err := keyEncryptor(Random, AES, oldKey, newKey).decryptData(original)
+	if err != nil {
+		t.Fatalf("decrypting the original line: %v", err)
+	}
+
+	decrypted, err := keyEncryptor(Random, AES, newKey).decryptData(rekeyed)
+
+	switch {
+	case err != nil:
+		t.Fatalf("decrypting the rekeyed line with the new key: %v", err)
+	case !bytes.Equal(decrypted, plaintext):
+		t.Fatalf("rekeyed line decrypts to %q, want %q", decrypted, plaintext)
+	case isJWECompact(rekeyed) != isJWECompact(original) || isFernet(rekeyed) != isFernet(original):
+		t.Fatalf("rekeyed line %q changed the format of %q", rekeyed, original)
+	}
+
+	header := lineHeader(original)
+	if header == nil {
+		return
+	}
+
+	rekeyedHeader := lineHeader(rekeyed)
+
+	switch {
+	case rekeyedHeader == nil || rekeyedHeader.Suite != header.Suite:
+		t.Fatalf("rekeyed line changed the suite of %q", original)
+	case !bytes.Equal(rekeyedHeader.Context, header.Context):
+		t.Fatalf("rekeyed line changed the context from %q to %q", header.Context, rekeyedHeader.Context)
+	}
+
+	for _, stanza := range header.Stanzas {
+		if isWrappedFor(stanza, []Identity{otherKey}) {
+			if _, err := keyEncryptor(Random, AES, otherKey).decryptData(rekeyed); err != nil {
+				t.Fatalf("decrypting the rekeyed line with the other recipient: %v", err)
+			}
+		}
+	}
+}
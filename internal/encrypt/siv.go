@@ -0,0 +1,201 @@
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+)
+
+// siv implements AES-SIV as specified in RFC 5297, a deterministic authenticated encryption mode:
+// encrypting the same plaintext with the same key and additional data always yields the same ciphertext,
+// without the security collapse that nonce reuse causes in modes like GCM.
+// Only the equality of plaintexts is revealed.
+//
+// It satisfies cipher.AEAD with a nonce size of zero.
+// A non-empty nonce may still be passed to Seal and Open, in which case it is
+// authenticated as an additional header component, as in the nonce-based use of SIV.
+type siv struct {
+	mac cipher.Block
+	ctr cipher.Block
+}
+
+// sivBlockSize is the AES block size, which is also the size of the synthetic IV.
+const sivBlockSize = aes.BlockSize
+
+// errOpen is returned by siv.Open when the ciphertext fails authentication.
+var errOpen = errors.New("message authentication failed")
+
+// newSIV creates an AES-SIV AEAD. The key must be 32, 48 or 64 bytes long: its first half is used for S2V,
+// its second half for CTR mode. A 64 bytes key gives AES-256-SIV.
+func newSIV(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 && len(key) != 48 && len(key) != 64 {
+		return nil, fmt.Errorf("creating SIV: invalid key size %d", len(key)) //nolint: err113
+	}
+
+	mac, err := aes.NewCipher(key[:len(key)/2])
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+
+	ctr, err := aes.NewCipher(key[len(key)/2:])
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+
+	return &siv{mac: mac, ctr: ctr}, nil
+}
+
+// NonceSize returns zero, as SIV does not require a nonce.
+func (s *siv) NonceSize() int {
+	return 0
+}
+
+// Overhead returns the size of the synthetic IV prepended to the ciphertext.
+func (s *siv) Overhead() int {
+	return sivBlockSize
+}
+
+// Seal encrypts and authenticates plaintext, authenticates additionalData and the (optional) nonce,
+// and appends the result to dst: [16 bytes synthetic IV][ciphertext].
+func (s *siv) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	iv := s.s2v(plaintext, components(additionalData, nonce)...)
+
+	ret, out := sliceForAppend(dst, len(iv)+len(plaintext))
+	copy(out, iv)
+	s.xorKeyStream(out[len(iv):], plaintext, iv)
+
+	return ret
+}
+
+// Open authenticates and decrypts ciphertext as produced by Seal and appends the plaintext to dst.
+func (s *siv) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < sivBlockSize {
+		return nil, errOpen
+	}
+
+	iv := ciphertext[:sivBlockSize]
+	ciphertext = ciphertext[sivBlockSize:]
+
+	ret, out := sliceForAppend(dst, len(ciphertext))
+	s.xorKeyStream(out, ciphertext, iv)
+
+	if subtle.ConstantTimeCompare(iv, s.s2v(out, components(additionalData, nonce)...)) != 1 {
+		clear(out)
+
+		return nil, errOpen
+	}
+
+	return ret, nil
+}
+
+// components returns the header components to authenticate: the additional data, and the nonce if given.
+func components(additionalData, nonce []byte) [][]byte {
+	if len(nonce) == 0 {
+		return [][]byte{additionalData}
+	}
+
+	return [][]byte{additionalData, nonce}
+}
+
+// s2v computes the synthetic IV over the header components and the plaintext (RFC 5297, section 2.4).
+func (s *siv) s2v(plaintext []byte, headers ...[]byte) []byte {
+	state := s.cmac(make([]byte, sivBlockSize))
+
+	for _, header := range headers {
+		double(state)
+		subtle.XORBytes(state, state, s.cmac(header))
+	}
+
+	var last []byte
+
+	if len(plaintext) >= sivBlockSize {
+		last = append([]byte{}, plaintext...)
+		subtle.XORBytes(last[len(last)-sivBlockSize:], last[len(last)-sivBlockSize:], state)
+	} else {
+		double(state)
+
+		last = make([]byte, sivBlockSize)
+		copy(last, plaintext)
+		last[len(plaintext)] = 0x80
+		subtle.XORBytes(last, last, state)
+	}
+
+	return s.cmac(last)
+}
+
+// cmac computes AES-CMAC (RFC 4493) of message with the S2V key.
+func (s *siv) cmac(message []byte) []byte {
+	subkey := make([]byte, sivBlockSize)
+	s.mac.Encrypt(subkey, subkey)
+	double(subkey)
+
+	// The final block is XORed with the first subkey if complete, or padded and XORed with the second one.
+	complete := len(message) > 0 && len(message)%sivBlockSize == 0
+	if !complete {
+		double(subkey)
+	}
+
+	blocks := (len(message) + sivBlockSize - 1) / sivBlockSize
+	if blocks == 0 {
+		blocks = 1
+	}
+
+	last := make([]byte, sivBlockSize)
+	copy(last, message[(blocks-1)*sivBlockSize:])
+
+	if !complete {
+		last[len(message)-(blocks-1)*sivBlockSize] = 0x80
+	}
+
+	subtle.XORBytes(last, last, subkey)
+
+	state := make([]byte, sivBlockSize)
+
+	for i := range blocks - 1 {
+		subtle.XORBytes(state, state, message[i*sivBlockSize:(i+1)*sivBlockSize])
+		s.mac.Encrypt(state, state)
+	}
+
+	subtle.XORBytes(state, state, last)
+	s.mac.Encrypt(state, state)
+
+	return state
+}
+
+// xorKeyStream applies AES-CTR with the counter derived from the synthetic IV,
+// with the 31st and 63rd bits (from the right) cleared as required by RFC 5297.
+func (s *siv) xorKeyStream(dst, src, iv []byte) {
+	counter := append([]byte{}, iv...)
+	counter[8] &= 0x7f
+	counter[12] &= 0x7f
+
+	cipher.NewCTR(s.ctr, counter).XORKeyStream(dst, src)
+}
+
+// double multiplies block by x in GF(2^128), in place.
+func double(block []byte) {
+	carry := block[0] >> 7
+
+	for i := range len(block) - 1 {
+		block[i] = block[i]<<1 | block[i+1]>>7
+	}
+
+	block[len(block)-1] = block[len(block)-1]<<1 ^ carry*0x87
+}
+
+// sliceForAppend extends in by n bytes, returning the whole slice and the extension.
+func sliceForAppend(in []byte, n int) ([]byte, []byte) {
+	total := len(in) + n
+
+	var head []byte
+	if cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+
+	return head, head[len(in):]
+}
@@ -0,0 +1,61 @@
+package encrypt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// TestSIVVector checks AES-SIV against the deterministic authenticated encryption example of RFC 5297, appendix A.1.
+func TestSIVVector(t *testing.T) {
+	t.Parallel()
+
+	key := decodeHex(t, "fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff")
+	additionalData := decodeHex(t, "101112131415161718191a1b1c1d1e1f2021222324252627")
+	plaintext := decodeHex(t, "112233445566778899aabbccddee")
+	want := decodeHex(t, "85632d07c6e8f37f950acd320a2ecc9340c02b9690c4dc04daef7f6afe5c")
+
+	aead, err := newSIV(key)
+	if err != nil {
+		t.Fatalf("newSIV: %v", err)
+	}
+
+	ciphertext := aead.Seal(nil, nil, plaintext, additionalData)
+	if !bytes.Equal(ciphertext, want) {
+		t.Fatalf("Seal = %x, want %x", ciphertext, want)
+	}
+
+	opened, err := aead.Open(nil, nil, ciphertext, additionalData)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	if !bytes.Equal(opened, plaintext) {
+		t.Fatalf("Open = %x, want %x", opened, plaintext)
+	}
+
+	for i := range ciphertext {
+		tampered := bytes.Clone(ciphertext)
+		tampered[i] ^= 1
+
+		if _, err := aead.Open(nil, nil, tampered, additionalData); err == nil {
+			t.Fatalf("Open accepted ciphertext with byte %d flipped", i)
+		}
+	}
+
+	if _, err := aead.Open(nil, nil, ciphertext, additionalData[1:]); err == nil {
+		t.Fatal("Open accepted different additional data")
+	}
+}
+
+// decodeHex decodes a hex test vector.
+func decodeHex(t *testing.T, encoded string) []byte {
+	t.Helper()
+
+	decoded, err := hex.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("decoding %q: %v", encoded, err)
+	}
+
+	return decoded
+}
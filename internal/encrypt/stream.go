@@ -1,108 +1,245 @@
 package encrypt
 
 import (
-	"crypto/aes"
+	"bufio"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 )
 
-// encryptStream encrypts data from reader to writer using AES-CFB mode.
-// It prepends the randomly generated IV to the encrypted output.
+const (
+	// chunkSize is the size of the plaintext chunks that are individually authenticated.
+	chunkSize = 64 * 1024
+
+	// nonceTrailerSize is the size of the part of each chunk nonce that holds the chunk counter
+	// and the last-chunk flag. The remaining leading bytes are a random per-file prefix.
+	// Deterministic suites do not take a nonce, and use the trailer alone without a prefix.
+	nonceTrailerSize = 5
+)
+
+// encryptStream encrypts data from reader to writer in a STREAM construction.
+// The output format is: [header][32 bytes header MAC][nonce prefix][chunk]...[final chunk].
+// The header is authenticated on its own with HMAC-SHA256, so that it can be verified
+// before any output is written.
+// Each chunk holds up to 64 KiB of plaintext followed by its authentication tag.
+// The chunk nonce combines the prefix, the chunk counter and a flag marking the final chunk,
+// so truncation, reordering and removal of chunks are all detected on decryption.
 // The encryption is done in chunks to maintain constant memory usage.
 func (e *Encryptor) encryptStream(reader io.Reader, writer io.Writer) error {
-	block, err := aes.NewCipher(e.Key)
+	header, key, err := e.newHeader()
 	if err != nil {
-		return fmt.Errorf("creating cipher: %w", err)
+		return err
 	}
 
-	// Generate a random IV (Initialization Vector)
-	initializationVector := make([]byte, aes.BlockSize)
-	if _, err := io.ReadFull(rand.Reader, initializationVector); err != nil {
-		return fmt.Errorf("generating IV: %w", err)
+	raw, err := header.MarshalBinary()
+	if err != nil {
+		return err
 	}
 
-	// Write IV directly
-	if _, err := writer.Write(initializationVector); err != nil {
-		return fmt.Errorf("writing IV: %w", err)
+	mac, err := headerMAC(key, raw)
+	if err != nil {
+		return err
 	}
 
-	stream := cipher.NewCFBEncrypter(block, initializationVector)
-	// Use fixed-size buffers for reading and encryption
-	const bufferSize = 4096
-
-	buf := make([]byte, bufferSize)
-	encrypted := make([]byte, bufferSize)
-
-	for {
-		n, err := reader.Read(buf)
-		if n > 0 {
-			stream.XORKeyStream(encrypted[:n], buf[:n])
-
-			if _, err := writer.Write(encrypted[:n]); err != nil {
-				return fmt.Errorf("writing encrypted data: %w", err)
-			}
-		}
+	aead, err := newAEAD(header, key, infoPayload)
+	if err != nil {
+		return err
+	}
 
-		if err == io.EOF {
-			break
-		}
+	prefix := make([]byte, noncePrefixSize(aead))
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		return fmt.Errorf("generating nonce prefix: %w", err)
+	}
 
-		if err != nil {
-			return fmt.Errorf("reading data: %w", err)
+	for _, part := range [][]byte{raw, mac, prefix} {
+		if _, err := writer.Write(part); err != nil {
+			return fmt.Errorf("writing header: %w", err)
 		}
 	}
 
-	return nil
+	return sealChunks(aead, prefix, nil, reader, writer)
 }
 
-// decryptStream decrypts data from reader to writer using AES-CFB mode.
-// It expects the IV to be prepended to the encrypted data.
-// The decryption is done in chunks to maintain constant memory usage.
+// decryptStream decrypts data from reader to writer.
+// Input starting with the magic is decrypted and authenticated according to its header,
+// age, Ansible Vault, OpenSSL and JWE files are handed to their own decryption,
+// and anything else to the legacy AES-CFB decryption.
+// Chunks are written as soon as they are authenticated; on error, the output
+// written so far must be discarded.
 func (e *Encryptor) decryptStream(reader io.Reader, writer io.Writer) error {
-	// Read the prepended IV
-	initializationVector := make([]byte, aes.BlockSize)
+	buffered := bufio.NewReader(reader)
+
+	if isAge(buffered) {
+		return e.decryptAge(buffered, writer)
+	}
+
+	if isVault(buffered) {
+		return e.decryptVaultFile(buffered, writer)
+	}
 
-	n, err := io.ReadFull(reader, initializationVector)
+	if isOpenSSL(buffered) {
+		return e.decryptOpenSSL(buffered, writer)
+	}
+
+	if isJWE(buffered) {
+		return e.decryptJWEFile(buffered, writer)
+	}
+
+	if !hasMagic(buffered) {
+		return e.decryptStreamCFB(buffered, writer)
+	}
+
+	if version, _ := buffered.Peek(len(magic) + 1); version[len(magic)] < headerVersion {
+		return e.decryptStreamPreHeader(buffered, writer)
+	}
+
+	header, raw, err := readHeader(buffered)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrProcessing, err)
+	}
+
+	mac := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(buffered, mac); err != nil {
+		return fmt.Errorf("%w: reading header MAC: %w", ErrProcessing, err)
+	}
+
+	key, err := e.keyFor(header)
 	if err != nil {
-		return fmt.Errorf("reading IV: %w", err)
+		return err
 	}
 
-	if n < aes.BlockSize {
-		return fmt.Errorf("%w: IV too short", ErrProcessing)
+	expected, err := headerMAC(key, raw)
+	if err != nil {
+		return err
 	}
 
-	block, err := aes.NewCipher(e.Key)
+	if !hmac.Equal(mac, expected) {
+		return fmt.Errorf("%w: wrong key or tampered header", ErrAuthentication)
+	}
+
+	aead, err := newAEAD(header, key, infoPayload)
 	if err != nil {
-		return fmt.Errorf("creating cipher: %w", err)
+		return fmt.Errorf("%w: %w", ErrProcessing, err)
+	}
+
+	prefix := make([]byte, noncePrefixSize(aead))
+	if _, err := io.ReadFull(buffered, prefix); err != nil {
+		return fmt.Errorf("%w: reading nonce prefix: %w", ErrProcessing, err)
 	}
 
-	stream := cipher.NewCFBDecrypter(block, initializationVector)
-	// Use fixed-size buffers for reading and decryption
-	const bufferSize = 4096
+	return openChunks(aead, prefix, nil, buffered, writer)
+}
+
+// sealChunks encrypts reader in chunks of chunkSize, flagging the final chunk.
+// An empty input results in a single, empty final chunk.
+func sealChunks(aead cipher.AEAD, prefix, additionalData []byte, reader io.Reader, writer io.Writer) error {
+	buffered := bufio.NewReaderSize(reader, chunkSize)
+	plaintext := make([]byte, chunkSize)
+	sealed := make([]byte, 0, chunkSize+aead.Overhead())
+
+	for counter := uint32(0); ; counter++ {
+		n, last, err := readChunk(buffered, plaintext)
+		if err != nil {
+			return fmt.Errorf("reading data: %w", err)
+		}
 
-	buf := make([]byte, bufferSize)
-	decrypted := make([]byte, bufferSize)
+		sealed = aead.Seal(sealed[:0], chunkNonce(prefix, counter, last), plaintext[:n], additionalData)
 
-	for {
-		n, err := reader.Read(buf)
-		if n > 0 {
-			stream.XORKeyStream(decrypted[:n], buf[:n])
+		if _, err := writer.Write(sealed); err != nil {
+			return fmt.Errorf("writing encrypted data: %w", err)
+		}
 
-			if _, err := writer.Write(decrypted[:n]); err != nil {
-				return fmt.Errorf("writing decrypted data: %w", err)
-			}
+		if last {
+			return nil
 		}
 
-		if err == io.EOF {
-			break
+		if counter == math.MaxUint32 {
+			return fmt.Errorf("%w: input too large", ErrProcessing)
 		}
+	}
+}
+
+// openChunks decrypts and authenticates the chunks written by sealChunks.
+func openChunks(aead cipher.AEAD, prefix, additionalData []byte, reader io.Reader, writer io.Writer) error {
+	buffered := bufio.NewReaderSize(reader, chunkSize+aead.Overhead())
+	sealed := make([]byte, chunkSize+aead.Overhead())
+	plaintext := make([]byte, 0, chunkSize)
 
+	for counter := uint32(0); ; counter++ {
+		n, last, err := readChunk(buffered, sealed)
 		if err != nil {
 			return fmt.Errorf("reading encrypted data: %w", err)
 		}
+
+		if n < aead.Overhead() {
+			return fmt.Errorf("%w: truncated ciphertext", ErrAuthentication)
+		}
+
+		plaintext, err = aead.Open(plaintext[:0], chunkNonce(prefix, counter, last), sealed[:n], additionalData)
+		if err != nil {
+			return fmt.Errorf("%w: wrong key or tampered ciphertext", ErrAuthentication)
+		}
+
+		if last && len(plaintext) == 0 && counter > 0 {
+			return fmt.Errorf("%w: unexpected empty final chunk", ErrAuthentication)
+		}
+
+		if _, err := writer.Write(plaintext); err != nil {
+			return fmt.Errorf("writing decrypted data: %w", err)
+		}
+
+		if last {
+			return nil
+		}
+
+		if counter == math.MaxUint32 {
+			return fmt.Errorf("%w: too many chunks", ErrAuthentication)
+		}
+	}
+}
+
+// readChunk fills buf from reader and reports whether the chunk is the final one,
+// which is the case when the input ends within or right after it.
+func readChunk(reader *bufio.Reader, buf []byte) (int, bool, error) {
+	n, err := io.ReadFull(reader, buf)
+
+	switch {
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return n, true, nil
+	case err != nil:
+		return n, false, err //nolint: wrapcheck
+	}
+
+	if _, err := reader.Peek(1); errors.Is(err, io.EOF) {
+		return n, true, nil
+	} else if err != nil {
+		return n, false, err //nolint: wrapcheck
+	}
+
+	return n, false, nil
+}
+
+// noncePrefixSize returns the size of the random nonce prefix for the AEAD.
+func noncePrefixSize(aead cipher.AEAD) int {
+	return max(aead.NonceSize()-nonceTrailerSize, 0)
+}
+
+// chunkNonce builds the nonce for a chunk: [prefix][4 bytes big-endian counter][last-chunk flag].
+func chunkNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, len(prefix)+nonceTrailerSize)
+
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[len(nonce)-nonceTrailerSize:], counter)
+
+	if last {
+		nonce[len(nonce)-1] = 1
 	}
 
-	return nil
+	return nonce
 }
@@ -0,0 +1,104 @@
+package encrypt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// TestStreamTampering checks that the STREAM construction detects truncated, reordered, removed and appended chunks.
+func TestStreamTampering(t *testing.T) {
+	t.Parallel()
+
+	key, err := NewSymmetricKey(bytes.Repeat([]byte{0x42}, KeySize))
+	if err != nil {
+		t.Fatalf("NewSymmetricKey: %v", err)
+	}
+
+	encryptor := &Encryptor{
+		Recipients: []Recipient{key},
+		Identities: []Identity{key},
+		Type:       Random,
+		Cipher:     AES,
+		Mode:       File,
+		Context:    "stream_test",
+	}
+
+	// Three chunks, the last one partial.
+	plaintext := bytes.Repeat([]byte("0123456789abcdef"), (2*chunkSize+1024)/16)
+
+	var ciphertext bytes.Buffer
+	if err := encryptor.encryptStream(bytes.NewReader(plaintext), &ciphertext); err != nil {
+		t.Fatalf("encryptStream: %v", err)
+	}
+
+	header, chunks := splitChunks(t, ciphertext.Bytes())
+	if len(chunks) != 3 {
+		t.Fatalf("got %d chunks, want 3", len(chunks))
+	}
+
+	tests := []struct {
+		name   string
+		chunks [][]byte
+	}{
+		{name: "no chunks", chunks: nil},
+		{name: "final chunk removed", chunks: chunks[:2]},
+		{name: "final chunk truncated", chunks: [][]byte{chunks[0], chunks[1], chunks[2][:len(chunks[2])-1]}},
+		{name: "chunks reordered", chunks: [][]byte{chunks[1], chunks[0], chunks[2]}},
+		{name: "middle chunk removed", chunks: [][]byte{chunks[0], chunks[2]}},
+		{name: "middle chunk duplicated", chunks: [][]byte{chunks[0], chunks[0], chunks[1], chunks[2]}},
+		{name: "data appended", chunks: [][]byte{chunks[0], chunks[1], chunks[2], []byte("extra")}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			tampered := slices.Concat(append([][]byte{header}, test.chunks...)...)
+
+			err := encryptor.decryptStream(bytes.NewReader(tampered), &bytes.Buffer{})
+			if !errors.Is(err, ErrAuthentication) {
+				t.Fatalf("decryptStream error = %v, want %v", err, ErrAuthentication)
+			}
+		})
+	}
+
+	var decrypted bytes.Buffer
+	if err := encryptor.decryptStream(bytes.NewReader(ciphertext.Bytes()), &decrypted); err != nil {
+		t.Fatalf("decryptStream: %v", err)
+	}
+
+	if !bytes.Equal(decrypted.Bytes(), plaintext) {
+		t.Fatal("decrypted data differs from the plaintext")
+	}
+}
+
+// splitChunks splits file-mode AES-GCM ciphertext into its header, up to and including the nonce prefix, and its chunks.
+func splitChunks(t *testing.T, ciphertext []byte) ([]byte, [][]byte) {
+	t.Helper()
+
+	_, raw, err := readHeader(bytes.NewReader(ciphertext))
+	if err != nil {
+		t.Fatalf("readHeader: %v", err)
+	}
+
+	aead, err := newGCM(make([]byte, KeySize))
+	if err != nil {
+		t.Fatalf("newGCM: %v", err)
+	}
+
+	offset := len(raw) + sha256.Size + noncePrefixSize(aead)
+	sealedSize := chunkSize + aead.Overhead()
+
+	var chunks [][]byte
+
+	for rest := ciphertext[offset:]; len(rest) > 0; {
+		size := min(sealedSize, len(rest))
+		chunks = append(chunks, rest[:size])
+		rest = rest[size:]
+	}
+
+	return ciphertext[:offset], chunks
+}
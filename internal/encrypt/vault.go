@@ -0,0 +1,215 @@
+package encrypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Ansible Vault format constants, see
+// https://docs.ansible.com/ansible/latest/vault_guide/vault_using_encrypted_content.html#ansible-vault-payload-format-1-1-1-2
+const (
+	vaultPrefix     = "$ANSIBLE_VAULT;"
+	vaultCipher     = "AES256"
+	vaultSaltSize   = 32
+	vaultIterations = 10000
+	vaultLineWidth  = 80
+
+	// vaultPayloadParts are the salt, HMAC and ciphertext of the payload
+	vaultPayloadParts = 3
+)
+
+// isVault reports whether the reader starts with an Ansible Vault file, without consuming any input.
+func isVault(reader *bufio.Reader) bool {
+	return hasPrefix(reader, vaultPrefix)
+}
+
+// password returns the password for formats keyed by a password only, which must be supplied as a passphrase.
+func (e *Encryptor) password(format Format) ([]byte, error) {
+	for _, identity := range e.Identities {
+		if passphrase, ok := identity.(*Passphrase); ok {
+			return passphrase.passphrase, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: the %s format requires a password", ErrWrongKey, format)
+}
+
+// encryptVaultFile encrypts the whole input from reader into an Ansible Vault file.
+func (e *Encryptor) encryptVaultFile(reader io.Reader, writer io.Writer) error {
+	plaintext, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("reading data: %w", err)
+	}
+
+	vault, err := e.encryptVault(plaintext)
+	if err != nil {
+		return err
+	}
+
+	if _, err := writer.Write(vault); err != nil {
+		return fmt.Errorf("writing encrypted data: %w", err)
+	}
+
+	return nil
+}
+
+// decryptVaultFile decrypts an Ansible Vault file from reader.
+func (e *Encryptor) decryptVaultFile(reader io.Reader, writer io.Writer) error {
+	vault, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("reading encrypted data: %w", err)
+	}
+
+	plaintext, err := e.decryptVault(vault)
+	if err != nil {
+		return err
+	}
+
+	if _, err := writer.Write(plaintext); err != nil {
+		return fmt.Errorf("writing decrypted data: %w", err)
+	}
+
+	return nil
+}
+
+// encryptVault encrypts the plaintext in the Ansible Vault format:
+// version 1.1, or 1.2 when a vault ID is set, with the payload wrapped at 80 characters
+// and terminated by a newline.
+func (e *Encryptor) encryptVault(plaintext []byte) ([]byte, error) {
+	password, err := e.password(AnsibleVault)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, vaultSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("generating salt: %w", err)
+	}
+
+	key, macKey, iv := vaultKeys(password, salt)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+
+	padding := aes.BlockSize - len(plaintext)%aes.BlockSize
+	ciphertext := append(bytes.Clone(plaintext), bytes.Repeat([]byte{byte(padding)}, padding)...)
+
+	cipher.NewCTR(block, iv).XORKeyStream(ciphertext, ciphertext)
+
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(ciphertext)
+
+	payload := hex.EncodeToString([]byte(strings.Join([]string{
+		hex.EncodeToString(salt),
+		hex.EncodeToString(mac.Sum(nil)),
+		hex.EncodeToString(ciphertext),
+	}, "\n")))
+
+	var buf bytes.Buffer
+
+	buf.WriteString(vaultPrefix)
+
+	if e.VaultID != "" {
+		fmt.Fprintf(&buf, "1.2;%s;%s\n", vaultCipher, e.VaultID)
+	} else {
+		fmt.Fprintf(&buf, "1.1;%s\n", vaultCipher)
+	}
+
+	for len(payload) > vaultLineWidth {
+		buf.WriteString(payload[:vaultLineWidth] + "\n")
+		payload = payload[vaultLineWidth:]
+	}
+
+	buf.WriteString(payload + "\n")
+
+	return buf.Bytes(), nil
+}
+
+// decryptVault decrypts Ansible Vault 1.1 or 1.2 content, as produced by encryptVault or ansible-vault.
+func (e *Encryptor) decryptVault(vault []byte) ([]byte, error) {
+	password, err := e.password(AnsibleVault)
+	if err != nil {
+		return nil, err
+	}
+
+	header, payload, _ := bytes.Cut(vault, []byte("\n"))
+
+	fields := strings.Split(strings.TrimSpace(string(header)), ";")
+
+	switch {
+	case len(fields) < 3 || fields[0]+";" != vaultPrefix:
+		return nil, fmt.Errorf("%w: invalid ansible vault header", ErrProcessing)
+	case fields[1] != "1.1" && fields[1] != "1.2":
+		return nil, fmt.Errorf("%w: unsupported ansible vault version %q", ErrProcessing, fields[1])
+	case fields[2] != vaultCipher:
+		return nil, fmt.Errorf("%w: unsupported ansible vault cipher %q", ErrProcessing, fields[2])
+	}
+
+	decoded, err := hex.DecodeString(strings.Join(strings.Fields(string(payload)), ""))
+	if err != nil {
+		return nil, fmt.Errorf("%w: decoding ansible vault: %w", ErrProcessing, err)
+	}
+
+	parts := strings.Split(string(decoded), "\n")
+	if len(parts) != vaultPayloadParts {
+		return nil, fmt.Errorf("%w: malformed ansible vault payload", ErrProcessing)
+	}
+
+	var salt, expected, ciphertext []byte
+
+	for i, part := range []*[]byte{&salt, &expected, &ciphertext} {
+		if *part, err = hex.DecodeString(parts[i]); err != nil {
+			return nil, fmt.Errorf("%w: decoding ansible vault: %w", ErrProcessing, err)
+		}
+	}
+
+	key, macKey, iv := vaultKeys(password, salt)
+
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(ciphertext)
+
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return nil, fmt.Errorf("%w: wrong vault password or tampered ciphertext", ErrAuthentication)
+	}
+
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("%w: invalid ansible vault ciphertext length", ErrProcessing)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCTR(block, iv).XORKeyStream(plaintext, ciphertext)
+
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize ||
+		!bytes.Equal(plaintext[len(plaintext)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, fmt.Errorf("%w: invalid ansible vault padding", ErrProcessing)
+	}
+
+	return plaintext[:len(plaintext)-padding], nil
+}
+
+// vaultKeys derives the AES key, HMAC key and CTR initial counter from the password,
+// as PBKDF2-HMAC-SHA256 with 10000 iterations over the salt.
+func vaultKeys(password, salt []byte) (key, macKey, iv []byte) {
+	derived := pbkdf2.Key(password, salt, vaultIterations, 2*aesKeySize+aes.BlockSize, sha256.New)
+
+	return derived[:aesKeySize], derived[aesKeySize : 2*aesKeySize], derived[2*aesKeySize:]
+}
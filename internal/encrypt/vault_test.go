@@ -0,0 +1,156 @@
+package encrypt
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Ansible Vault vectors for the password "ansible", produced by a port of ansible's VaultAES256
+// with fixed salts, encrypting with the openssl CLI.
+const (
+	// vaultFile is the output of ansible-vault encrypt for the salt 00 01 .. 1f.
+	vaultFile = `$ANSIBLE_VAULT;1.1;AES256
+30303031303230333034303530363037303830393061306230633064306530663130313131323133
+3134313531363137313831393161316231633164316531660a393032616633623639643761343562
+39656431323362663035663335393066613563663835313263386239383331663131623038343838
+3562636664393262310a343434343236356366323463343636323839663030616162316363303532
+66326435356566303231313036353164323737356234323763636565386239666536616364386234
+3639393234326536303265316462343231393764623361326239
+`
+
+	// vaultString is the output of ansible-vault encrypt_string --vault-id prod@... --name db_password hunter2
+	// for the salt 20 21 .. 3f, in a YAML file.
+	vaultString = `db:
+  user: admin
+db_password: !vault |
+          $ANSIBLE_VAULT;1.2;AES256;prod
+          32303231323232333234323532363237323832393261326232633264326532663330333133323333
+          3334333533363337333833393361336233633364336533660a306163363064653564366437303536
+          32633334333533366535656664336137633835356539633935633762333363373431323330333562
+          3930623533626431320a323735363935653032633732333166386565646433366330333166656330
+          3161
+port: 22
+`
+)
+
+// TestVaultVectors decrypts files and inline scalars encrypted by ansible-vault.
+func TestVaultVectors(t *testing.T) {
+	t.Parallel()
+
+	directives := Directives{Encrypt: "### DIRECTIVE: ENCRYPT", Decrypt: "### DIRECTIVE: DECRYPT"}
+
+	tests := []struct {
+		name     string
+		mode     Mode
+		input    string
+		password string
+		want     string
+		err      error
+	}{
+		{
+			name:     "file",
+			mode:     File,
+			input:    vaultFile,
+			password: "ansible",
+			want:     "db_user: admin\ndb_password: hunter2\n",
+		},
+		{
+			name:     "encrypt_string",
+			mode:     Line,
+			input:    vaultString,
+			password: "ansible",
+			want:     "db:\n  user: admin\ndb_password: hunter2 ### DIRECTIVE: ENCRYPT\nport: 22\n",
+		},
+		{
+			name:     "wrong password",
+			mode:     File,
+			input:    vaultFile,
+			password: "ansible2",
+			err:      ErrAuthentication,
+		},
+		{
+			name:     "tampered",
+			mode:     File,
+			input:    strings.Replace(vaultFile, "3639393234", "3639393235", 1),
+			password: "ansible",
+			err:      ErrAuthentication,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			decrypted, err := processData(&Encryptor{
+				Operation:  Decrypt,
+				Mode:       test.mode,
+				Format:     AnsibleVault,
+				Directives: directives,
+				Identities: []Identity{NewPassphrase([]byte(test.password), KDFArgon2id)},
+			}, []byte(test.input))
+
+			switch {
+			case test.err != nil && !errors.Is(err, test.err):
+				t.Fatalf("decrypting: error = %v, want %v", err, test.err)
+			case test.err == nil && err != nil:
+				t.Fatalf("decrypting: %v", err)
+			case string(decrypted) != test.want && test.err == nil:
+				t.Fatalf("decrypted %q, want %q", decrypted, test.want)
+			}
+		})
+	}
+}
+
+// TestVaultRoundTrip encrypts in the layout ansible-vault writes, and decrypts the output again.
+func TestVaultRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	password := NewPassphrase([]byte("ansible"), KDFArgon2id)
+	plaintext := strings.Repeat("db_password: hunter2\n", 20)
+
+	tests := []struct {
+		name    string
+		vaultID string
+		header  string
+	}{
+		{name: "1.1", header: "$ANSIBLE_VAULT;1.1;AES256"},
+		{name: "1.2", vaultID: "prod", header: "$ANSIBLE_VAULT;1.2;AES256;prod"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			encrypted, err := processData(&Encryptor{
+				Operation:  Encrypt,
+				Format:     AnsibleVault,
+				VaultID:    test.vaultID,
+				Identities: []Identity{password},
+			}, []byte(plaintext))
+			if err != nil {
+				t.Fatalf("encrypting: %v", err)
+			}
+
+			lines := strings.Split(strings.TrimSuffix(string(encrypted), "\n"), "\n")
+			if lines[0] != test.header {
+				t.Fatalf("header = %q, want %q", lines[0], test.header)
+			}
+
+			for i, line := range lines[1:] {
+				if len(line) != vaultLineWidth && i != len(lines)-2 {
+					t.Fatalf("payload line %d has %d characters, want %d", i+1, len(line), vaultLineWidth)
+				}
+			}
+
+			decrypted, err := processData(&Encryptor{Operation: Decrypt, Identities: []Identity{password}}, encrypted)
+
+			switch {
+			case err != nil:
+				t.Fatalf("decrypting: %v", err)
+			case string(decrypted) != plaintext:
+				t.Fatalf("decrypted %q, want %q", decrypted, plaintext)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package encrypt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// vaultScalar matches a YAML key (or list item) introducing an inline vault scalar, such as `password: !vault |`.
+var vaultScalar = regexp.MustCompile(`^(\s*)(.*:)\s+!vault\s+\|[-+]?\s*$`)
+
+// processVaultLines processes YAML line by line, using inline Ansible Vault scalars instead of directives.
+//   - When encrypting, the value of each `key: value` line marked with the encrypt directive
+//     is replaced by an inline `!vault |` scalar, indented below the key.
+//   - When decrypting, each inline `!vault |` scalar is replaced by its value, marked with the encrypt directive,
+//     so that encrypting the output again restores the vault.
+//
+// Returns true if any value was encrypted or decrypted.
+func (e *Encryptor) processVaultLines(reader io.Reader, writer io.Writer) (bool, error) {
+	var lines []string
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("%w: scanning error: %w", ErrProcessing, err)
+	}
+
+	var (
+		output    []string
+		processed bool
+	)
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		switch {
+		case e.Operation == Encrypt && strings.HasSuffix(line, e.Directives.Encrypt):
+			encrypted, err := e.encryptVaultLine(strings.TrimSuffix(line, e.Directives.Encrypt))
+			if err != nil {
+				return false, fmt.Errorf("line %d: %w", i+1, err)
+			}
+
+			output = append(output, encrypted...)
+			processed = true
+
+		case e.Operation == Decrypt && vaultScalar.MatchString(line):
+			match := vaultScalar.FindStringSubmatch(line)
+			indent, key, start := match[1], match[2], i+1
+
+			// The scalar spans all following lines indented deeper than the key
+			var vault strings.Builder
+
+			for i+1 < len(lines) && (strings.TrimSpace(lines[i+1]) == "" || indentation(lines[i+1]) > len(indent)) {
+				i++
+
+				vault.WriteString(strings.TrimSpace(lines[i]) + "\n")
+			}
+
+			plaintext, err := e.decryptVault([]byte(vault.String()))
+			if err != nil {
+				return false, fmt.Errorf("line %d: %w", start, err)
+			}
+
+			value, err := yamlScalar(string(plaintext))
+			if err != nil {
+				return false, err
+			}
+
+			output = append(output, fmt.Sprintf("%s%s %s %s", indent, key, value, e.Directives.Encrypt))
+			processed = true
+
+		default:
+			output = append(output, line)
+		}
+	}
+
+	for _, line := range output {
+		if _, err := fmt.Fprintln(writer, line); err != nil {
+			return false, fmt.Errorf("%w: writing error: %w", ErrProcessing, err)
+		}
+	}
+
+	return processed, nil
+}
+
+// encryptVaultLine encrypts the value of a `key: value` line into an inline vault scalar,
+// returned as the lines replacing it.
+func (e *Encryptor) encryptVaultLine(line string) ([]string, error) {
+	key, raw, found := strings.Cut(line, ": ")
+	if !found {
+		return nil, fmt.Errorf("%w: expected a `key: value` line", ErrProcessing)
+	}
+
+	var value string
+	if err := yaml.Unmarshal([]byte(raw), &value); err != nil {
+		return nil, fmt.Errorf("%w: parsing value: %w", ErrProcessing, err)
+	}
+
+	vault, err := e.encryptVault([]byte(value))
+	if err != nil {
+		return nil, err
+	}
+
+	const nesting = 2
+
+	indent := strings.Repeat(" ", indentation(line)+nesting)
+
+	lines := []string{key + ": !vault |"}
+	for _, vaultLine := range strings.Split(strings.TrimSuffix(string(vault), "\n"), "\n") {
+		lines = append(lines, indent+vaultLine)
+	}
+
+	return lines, nil
+}
+
+// indentation returns the number of leading spaces and tabs of the line.
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+// yamlScalar formats the value as a single-line YAML scalar, quoting it as needed.
+func yamlScalar(value string) (string, error) {
+	node := &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+	if strings.Contains(value, "\n") {
+		node.Style = yaml.DoubleQuotedStyle
+	}
+
+	out, err := yaml.Marshal(node)
+	if err != nil {
+		return "", fmt.Errorf("%w: formatting value: %w", ErrProcessing, err)
+	}
+
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
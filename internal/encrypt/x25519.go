@@ -0,0 +1,192 @@
+package encrypt
+
+import (
+	"bufio"
+	"crypto/ecdh"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/idelchi/gocry/internal/bech32"
+)
+
+// Bech32 prefixes of X25519 keys, compatible with the keys of age (https://age-encryption.org).
+const (
+	x25519RecipientPrefix = "age"
+	x25519IdentityPrefix  = "AGE-SECRET-KEY-"
+)
+
+// infoX25519 labels the derivation of the wrapping key from the X25519 shared secret.
+const infoX25519 = "gocry/v3/x25519\x00"
+
+// StanzaX25519 holds the data key wrapped for an X25519 public key.
+// Its arguments are the ephemeral public key.
+const StanzaX25519 StanzaType = 3
+
+// X25519Recipient is an X25519 public key, which data keys can be wrapped for.
+type X25519Recipient struct {
+	key *ecdh.PublicKey
+}
+
+// ParseX25519Recipient parses a Bech32-encoded public key starting with "age1".
+func ParseX25519Recipient(encoded string) (*X25519Recipient, error) {
+	hrp, data, err := bech32.Decode(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("parsing recipient %q: %w", encoded, err)
+	}
+
+	if hrp != x25519RecipientPrefix {
+		return nil, fmt.Errorf("parsing recipient %q: unknown type %q", encoded, hrp) //nolint: err113
+	}
+
+	key, err := ecdh.X25519().NewPublicKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing recipient %q: %w", encoded, err)
+	}
+
+	return &X25519Recipient{key: key}, nil
+}
+
+// String returns the Bech32 encoding of the public key.
+func (r *X25519Recipient) String() string {
+	encoded, _ := bech32.Encode(x25519RecipientPrefix, r.key.Bytes())
+
+	return encoded
+}
+
+// Wrap wraps the data key with a key agreed between a fresh ephemeral key and the public key.
+func (r *X25519Recipient) Wrap(dataKey []byte) (*Stanza, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generating ephemeral key: %w", err)
+	}
+
+	shared, err := ephemeral.ECDH(r.key)
+	if err != nil {
+		return nil, fmt.Errorf("computing shared secret: %w", err)
+	}
+
+	key, err := x25519WrapKey(shared, ephemeral.PublicKey(), r.key)
+	if err != nil {
+		return nil, err
+	}
+
+	stanza := &Stanza{Type: StanzaX25519, Args: ephemeral.PublicKey().Bytes()}
+
+	return stanza, sealDataKey(key, stanza, dataKey)
+}
+
+// X25519Identity is an X25519 private key, which unwraps data keys wrapped for its public key.
+type X25519Identity struct {
+	key *ecdh.PrivateKey
+}
+
+// GenerateX25519Identity creates a new random identity.
+func GenerateX25519Identity() (*X25519Identity, error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generating key: %w", err)
+	}
+
+	return &X25519Identity{key: key}, nil
+}
+
+// ParseX25519Identity parses a Bech32-encoded private key starting with "AGE-SECRET-KEY-1".
+func ParseX25519Identity(encoded string) (*X25519Identity, error) {
+	hrp, data, err := bech32.Decode(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("parsing identity: %w", err)
+	}
+
+	if hrp != strings.ToLower(x25519IdentityPrefix) {
+		return nil, fmt.Errorf("parsing identity: unknown type %q", hrp) //nolint: err113
+	}
+
+	key, err := ecdh.X25519().NewPrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing identity: %w", err)
+	}
+
+	return &X25519Identity{key: key}, nil
+}
+
+// ParseX25519Identities parses an identity file, holding one identity per line.
+// Empty lines and lines starting with "#" are ignored.
+func ParseX25519Identities(reader io.Reader) ([]*X25519Identity, error) {
+	var identities []*X25519Identity
+
+	scanner := bufio.NewScanner(reader)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		identity, err := ParseX25519Identity(line)
+		if err != nil {
+			return nil, err
+		}
+
+		identities = append(identities, identity)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading identities: %w", err)
+	}
+
+	if len(identities) == 0 {
+		return nil, fmt.Errorf("%w: no identities found", ErrProcessing)
+	}
+
+	return identities, nil
+}
+
+// Encode returns the Bech32 encoding of the private key, in uppercase.
+func (i *X25519Identity) Encode() string {
+	encoded, _ := bech32.Encode(x25519IdentityPrefix, i.key.Bytes())
+
+	return strings.ToUpper(encoded)
+}
+
+// Recipient returns the public key matching the identity.
+func (i *X25519Identity) Recipient() *X25519Recipient {
+	return &X25519Recipient{key: i.key.PublicKey()}
+}
+
+// String describes the identity by its public key, without revealing the private key.
+func (i *X25519Identity) String() string {
+	return "identity " + i.Recipient().String()
+}
+
+// Unwrap unwraps data keys wrapped for the public key of the identity.
+// As the stanza does not reveal the recipient, any stanza that fails to unwrap is reported as errNotRecipient.
+func (i *X25519Identity) Unwrap(stanza *Stanza) ([]byte, error) {
+	if stanza.Type != StanzaX25519 {
+		return nil, errNotRecipient
+	}
+
+	ephemeral, err := ecdh.X25519().NewPublicKey(stanza.Args)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid ephemeral key: %w", ErrHeader, err)
+	}
+
+	shared, err := i.key.ECDH(ephemeral)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid ephemeral key: %w", ErrHeader, err)
+	}
+
+	key, err := x25519WrapKey(shared, ephemeral, i.key.PublicKey())
+	if err != nil {
+		return nil, err
+	}
+
+	return openDataKey(key, stanza)
+}
+
+// x25519WrapKey derives the wrapping key from the X25519 shared secret,
+// bound to both the ephemeral and the recipient public key.
+func x25519WrapKey(shared []byte, ephemeral, recipient *ecdh.PublicKey) ([]byte, error) {
+	return deriveKey(shared, infoX25519+string(ephemeral.Bytes())+string(recipient.Bytes()), aesKeySize)
+}
@@ -0,0 +1,266 @@
+// Package gitcrypt reads git-crypt symmetric key files and decrypts files encrypted by git-crypt,
+// for migrating repositories to gocry.
+//
+// See https://github.com/AGWA/git-crypt for the formats.
+package gitcrypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1" //nolint: gosec
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var (
+	// ErrKey indicates a malformed or unsupported key file.
+	ErrKey = errors.New("invalid git-crypt key")
+
+	// ErrFile indicates a malformed file, or one that fails authentication with the keys.
+	ErrFile = errors.New("invalid git-crypt file")
+)
+
+const (
+	// keyMagic starts key files in the current format, followed by the format version.
+	keyMagic = "\x00GITCRYPTKEY"
+
+	// keyFormatVersion is the only supported key file format version.
+	keyFormatVersion = 2
+
+	// fileMagic starts encrypted files, followed by the nonce.
+	fileMagic = "\x00GITCRYPT\x00"
+
+	// nonceSize is the size of the nonce, the truncated HMAC-SHA1 of the plaintext.
+	nonceSize = 12
+
+	aesKeySize  = 32
+	hmacKeySize = 64
+	versionSize = 4
+
+	// maxFieldSize bounds the size of unknown fields skipped in key files.
+	maxFieldSize = 1 << 20
+)
+
+// Key file field identifiers. Unknown fields with an odd identifier are critical and must not be skipped.
+const (
+	fieldEnd     = 0
+	fieldVersion = 1
+	fieldAESKey  = 3
+	fieldHMACKey = 5
+)
+
+// Key is a single version of a git-crypt key.
+type Key struct {
+	// Version is the key version
+	Version uint32
+
+	// AES is the AES-256 key used in CTR mode
+	AES []byte
+
+	// HMAC is the HMAC-SHA1 key used to derive the nonce
+	HMAC []byte
+}
+
+// ParseKeyFile parses a git-crypt symmetric key file, as exported by `git-crypt export-key`
+// or found in .git/git-crypt/keys, in either the current or the legacy format.
+func ParseKeyFile(data []byte) ([]Key, error) {
+	if !bytes.HasPrefix(data, []byte(keyMagic)) {
+		// Legacy key files hold the AES and HMAC keys only
+		if len(data) != aesKeySize+hmacKeySize {
+			return nil, fmt.Errorf("%w: unknown format", ErrKey)
+		}
+
+		return []Key{{AES: data[:aesKeySize], HMAC: data[aesKeySize:]}}, nil
+	}
+
+	reader := bytes.NewReader(data[len(keyMagic):])
+
+	var version uint32
+	if err := binary.Read(reader, binary.BigEndian, &version); err != nil {
+		return nil, fmt.Errorf("%w: reading format version: %w", ErrKey, err)
+	}
+
+	if version != keyFormatVersion {
+		return nil, fmt.Errorf("%w: unsupported format version %d", ErrKey, version)
+	}
+
+	// The header only holds the optional key name, which is of no use here
+	if err := readFields(reader, func(uint32, []byte) error { return nil }); err != nil {
+		return nil, err
+	}
+
+	var keys []Key
+
+	for reader.Len() > 0 {
+		var key Key
+
+		err := readFields(reader, func(id uint32, value []byte) error {
+			switch id {
+			case fieldVersion:
+				if len(value) != versionSize {
+					return fmt.Errorf("%w: invalid key version", ErrKey)
+				}
+
+				key.Version = binary.BigEndian.Uint32(value)
+			case fieldAESKey:
+				key.AES = value
+			case fieldHMACKey:
+				key.HMAC = value
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(key.AES) != aesKeySize || len(key.HMAC) != hmacKeySize {
+			return nil, fmt.Errorf("%w: key version %d is incomplete", ErrKey, key.Version)
+		}
+
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: no keys", ErrKey)
+	}
+
+	return keys, nil
+}
+
+// readFields reads [4 bytes id][4 bytes length][value] fields up to the end field,
+// passing each to handle. Unknown critical (odd) fields are rejected.
+func readFields(reader *bytes.Reader, handle func(id uint32, value []byte) error) error {
+	for {
+		var id uint32
+		if err := binary.Read(reader, binary.BigEndian, &id); err != nil {
+			return fmt.Errorf("%w: reading field: %w", ErrKey, err)
+		}
+
+		if id == fieldEnd {
+			return nil
+		}
+
+		var length uint32
+		if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+			return fmt.Errorf("%w: reading field length: %w", ErrKey, err)
+		}
+
+		if length > maxFieldSize || int(length) > reader.Len() {
+			return fmt.Errorf("%w: field %d too long", ErrKey, id)
+		}
+
+		value := make([]byte, length)
+		if _, err := io.ReadFull(reader, value); err != nil {
+			return fmt.Errorf("%w: reading field value: %w", ErrKey, err)
+		}
+
+		switch id {
+		case fieldVersion, fieldAESKey, fieldHMACKey:
+		default:
+			if id&1 == 1 {
+				return fmt.Errorf("%w: unsupported critical field %d", ErrKey, id)
+			}
+		}
+
+		if err := handle(id, value); err != nil {
+			return err
+		}
+	}
+}
+
+// IsEncrypted reports whether the reader starts with a git-crypt encrypted file, without consuming any input.
+func IsEncrypted(reader *bufio.Reader) bool {
+	prefix, err := reader.Peek(len(fileMagic))
+
+	return err == nil && bytes.Equal(prefix, []byte(fileMagic))
+}
+
+// Decrypt decrypts a git-crypt encrypted file: [\0GITCRYPT\0][12 bytes nonce][AES-256-CTR ciphertext].
+// The nonce is the truncated HMAC-SHA1 of the plaintext, which authenticates it.
+// Each key is tried in turn, as the file does not record the key version.
+func Decrypt(data []byte, keys []Key) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(fileMagic)) || len(data) < len(fileMagic)+nonceSize {
+		return nil, fmt.Errorf("%w: missing header", ErrFile)
+	}
+
+	nonce := data[len(fileMagic) : len(fileMagic)+nonceSize]
+	ciphertext := data[len(fileMagic)+nonceSize:]
+
+	for _, key := range keys {
+		block, err := aes.NewCipher(key.AES)
+		if err != nil {
+			return nil, fmt.Errorf("creating cipher: %w", err)
+		}
+
+		// The counter block is the nonce followed by a 32 bits big-endian block counter
+		iv := make([]byte, aes.BlockSize)
+		copy(iv, nonce)
+
+		plaintext := make([]byte, len(ciphertext))
+		cipher.NewCTR(block, iv).XORKeyStream(plaintext, ciphertext)
+
+		mac := hmac.New(sha1.New, key.HMAC)
+		mac.Write(plaintext)
+
+		if hmac.Equal(mac.Sum(nil)[:nonceSize], nonce) {
+			return plaintext, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: authentication failed, wrong key or tampered file", ErrFile)
+}
+
+// RewriteAttributes rewrites .gitattributes content so that paths using the git-crypt filter use
+// the given filter instead, and drops the git-crypt diff driver.
+// The filter and diff driver of named keys, git-crypt-<name>, are rewritten and dropped as well.
+// It returns the rewritten content and the number of lines changed.
+func RewriteAttributes(content []byte, filter string) ([]byte, int) {
+	lines := strings.SplitAfter(string(content), "\n")
+	changed := 0
+
+	for i, line := range lines {
+		body := strings.TrimRight(line, "\r\n")
+		fields := strings.Fields(body)
+
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		attributes := fields[:1]
+		modified := false
+
+		for _, attribute := range fields[1:] {
+			switch {
+			case isGitCryptAttribute(attribute, "filter"):
+				attributes = append(attributes, "filter="+filter)
+				modified = true
+			case isGitCryptAttribute(attribute, "diff"):
+				modified = true
+			default:
+				attributes = append(attributes, attribute)
+			}
+		}
+
+		if modified {
+			lines[i] = strings.Join(attributes, " ") + line[len(body):]
+			changed++
+		}
+	}
+
+	return []byte(strings.Join(lines, "")), changed
+}
+
+// isGitCryptAttribute reports whether the attribute sets the named attribute to git-crypt,
+// or to git-crypt-<name> for a named key.
+func isGitCryptAttribute(attribute, name string) bool {
+	value, ok := strings.CutPrefix(attribute, name+"=")
+
+	return ok && (value == "git-crypt" || strings.HasPrefix(value, "git-crypt-"))
+}
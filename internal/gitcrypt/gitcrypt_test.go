@@ -0,0 +1,205 @@
+package gitcrypt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// git-crypt vectors, produced by a port of the key file and encryption code of git-crypt 0.7.
+// Key version 0 has the AES key 00 01 .. 1f and the HMAC key 40 41 .. 7f,
+// key version 1 the AES key 20 21 .. 3f and the HMAC key 80 81 .. bf.
+const (
+	// keyFile holds both key versions, the newest first, as written by `git-crypt export-key`.
+	keyFile = "0047495443525950544b455900000002" + "00000000" +
+		"00000001000000040000000100000003000000202021222324252627" +
+		"28292a2b2c2d2e2f303132333435363738393a3b3c3d3e3f0000000500000040808182838485868788898a8b8c8d8e8f" +
+		"909192939495969798999a9b9c9d9e9fa0a1a2a3a4a5a6a7a8a9aaabacadaeafb0b1b2b3b4b5b6b7b8b9babbbcbdbebf" +
+		"00000000" +
+		"00000001000000040000000000000003000000200001020304050607" +
+		"08090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f0000000500000040404142434445464748494a4b4c4d4e4f" +
+		"505152535455565758595a5b5c5d5e5f606162636465666768696a6b6c6d6e6f707172737475767778797a7b7c7d7e7f" +
+		"00000000"
+
+	// namedKeyFile holds key version 0 under the name prod, as used with `git-crypt init -k prod`.
+	namedKeyFile = "0047495443525950544b455900000002" + "000000010000000470726f64" + "00000000" +
+		"00000001000000040000000000000003000000200001020304050607" +
+		"08090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f0000000500000040404142434445464748494a4b4c4d4e4f" +
+		"505152535455565758595a5b5c5d5e5f606162636465666768696a6b6c6d6e6f707172737475767778797a7b7c7d7e7f" +
+		"00000000"
+
+	// blobVersion0 is "password: hunter2\n" encrypted with key version 0.
+	blobVersion0 = "00474954435259505400" + "faca2ecc1a1fa82bf46c8db7" + "0b2c314b30da0ff099b24efa7a365279ac22"
+
+	// blobVersion1 is 40 times "x" encrypted with key version 1.
+	blobVersion1 = "00474954435259505400" + "626d5039b0640056f2e0060c" +
+		"dbfd79f04b4f4321bca072d89a1ab24c576c5fd824a31d5843f12e8587e4329086cd0b5f4c4c5171"
+)
+
+// decodeHex decodes a hex test vector.
+func decodeHex(t *testing.T, encoded string) []byte {
+	t.Helper()
+
+	decoded, err := hex.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("decoding %q: %v", encoded, err)
+	}
+
+	return decoded
+}
+
+// sequence returns the n bytes counting up from start.
+func sequence(start byte, n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = start + byte(i)
+	}
+
+	return data
+}
+
+// TestParseKeyFile parses key files in the current and legacy formats, and rejects malformed ones.
+func TestParseKeyFile(t *testing.T) {
+	t.Parallel()
+
+	version0 := Key{Version: 0, AES: sequence(0x00, aesKeySize), HMAC: sequence(0x40, hmacKeySize)}
+	version1 := Key{Version: 1, AES: sequence(0x20, aesKeySize), HMAC: sequence(0x80, hmacKeySize)}
+
+	tests := []struct {
+		name string
+		data []byte
+		want []Key
+	}{
+		{name: "versions", data: decodeHex(t, keyFile), want: []Key{version1, version0}},
+		{name: "named", data: decodeHex(t, namedKeyFile), want: []Key{version0}},
+		{name: "legacy", data: append(sequence(0x00, aesKeySize), sequence(0x40, hmacKeySize)...), want: []Key{version0}},
+		{name: "truncated", data: decodeHex(t, keyFile)[:100]},
+		{name: "format version", data: decodeHex(t, strings.Replace(keyFile, "00000002", "00000003", 1))},
+		{name: "critical field", data: decodeHex(t, strings.Replace(keyFile, "0000000300000020", "0000000700000020", 1))},
+		{name: "no keys", data: decodeHex(t, "0047495443525950544b455900000002"+"00000000")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			keys, err := ParseKeyFile(test.data)
+
+			switch {
+			case test.want == nil && !errors.Is(err, ErrKey):
+				t.Fatalf("ParseKeyFile error = %v, want %v", err, ErrKey)
+			case test.want == nil:
+				return
+			case err != nil:
+				t.Fatalf("ParseKeyFile: %v", err)
+			case len(keys) != len(test.want):
+				t.Fatalf("ParseKeyFile returned %d keys, want %d", len(keys), len(test.want))
+			}
+
+			for i, key := range keys {
+				want := test.want[i]
+				if key.Version != want.Version || !bytes.Equal(key.AES, want.AES) || !bytes.Equal(key.HMAC, want.HMAC) {
+					t.Fatalf("key %d = %+v, want %+v", i, key, want)
+				}
+			}
+		})
+	}
+}
+
+// TestDecrypt decrypts files encrypted by git-crypt with any version of the key.
+func TestDecrypt(t *testing.T) {
+	t.Parallel()
+
+	keys, err := ParseKeyFile(decodeHex(t, keyFile))
+	if err != nil {
+		t.Fatalf("ParseKeyFile: %v", err)
+	}
+
+	tampered := decodeHex(t, blobVersion0)
+	tampered[len(tampered)-1] ^= 1
+
+	tests := []struct {
+		name string
+		blob []byte
+		keys []Key
+		want string
+	}{
+		{name: "version 0", blob: decodeHex(t, blobVersion0), keys: keys, want: "password: hunter2\n"},
+		{name: "version 1", blob: decodeHex(t, blobVersion1), keys: keys, want: strings.Repeat("x", 40)},
+		{name: "wrong key", blob: decodeHex(t, blobVersion1), keys: keys[1:]},
+		{name: "tampered", blob: tampered, keys: keys},
+		{name: "truncated", blob: decodeHex(t, blobVersion0)[:15], keys: keys},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			plaintext, err := Decrypt(test.blob, test.keys)
+
+			switch {
+			case test.want == "" && !errors.Is(err, ErrFile):
+				t.Fatalf("Decrypt error = %v, want %v", err, ErrFile)
+			case test.want == "":
+				return
+			case err != nil:
+				t.Fatalf("Decrypt: %v", err)
+			case string(plaintext) != test.want:
+				t.Fatalf("Decrypt = %q, want %q", plaintext, test.want)
+			}
+		})
+	}
+}
+
+// TestRewriteAttributes rewrites the git-crypt filter entries of the default and named keys.
+func TestRewriteAttributes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		changed int
+	}{
+		{
+			name:    "default key",
+			content: "secrets/** filter=git-crypt diff=git-crypt\n",
+			want:    "secrets/** filter=gocry\n",
+			changed: 1,
+		},
+		{
+			name:    "named keys",
+			content: "prod/** filter=git-crypt-prod diff=git-crypt-prod\r\nstaging/** filter=git-crypt-staging\r\n",
+			want:    "prod/** filter=gocry\r\nstaging/** filter=gocry\r\n",
+			changed: 2,
+		},
+		{
+			name:    "other attributes",
+			content: "# filter=git-crypt\n*.png binary\n*.sh text eol=lf diff=git-crypted\n",
+			want:    "# filter=git-crypt\n*.png binary\n*.sh text eol=lf diff=git-crypted\n",
+		},
+		{
+			name:    "kept attributes",
+			content: "*.key filter=git-crypt-prod -text merge=binary",
+			want:    "*.key filter=gocry -text merge=binary",
+			changed: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			content, changed := RewriteAttributes([]byte(test.content), "gocry")
+
+			switch {
+			case string(content) != test.want:
+				t.Fatalf("RewriteAttributes = %q, want %q", content, test.want)
+			case changed != test.changed:
+				t.Fatalf("RewriteAttributes changed %d lines, want %d", changed, test.changed)
+			}
+		})
+	}
+}
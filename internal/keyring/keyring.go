@@ -0,0 +1,176 @@
+// Package keyring reads keyring files of named, versioned keys, so that keys can be rotated
+// while ciphertext encrypted with earlier versions keeps decrypting.
+//
+// A keyring is a YAML file listing the keys:
+//
+//	keys:
+//	  - name: prod
+//	    version: 1
+//	    key: 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08
+//	    created: 2024-01-01T00:00:00Z
+//	    retired: 2024-06-01T00:00:00Z
+//	  - name: prod
+//	    version: 2
+//	    key: 60303ae22b998861bce3b28f33eec1be758a213c86c93c076dbe9f558c11c752
+//	    created: 2024-06-01T00:00:00Z
+//
+// Each name has at most one active (not retired) version, which is the one encrypted with.
+// Retired versions are only decrypted with.
+package keyring
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrKeyring indicates a malformed keyring, or one without a matching key.
+var ErrKeyring = errors.New("invalid keyring")
+
+// Entry is a single version of a named key.
+type Entry struct {
+	// Name identifies the key across versions
+	Name string `yaml:"name"`
+
+	// Version distinguishes the versions of the key, starting at 1
+	Version int `yaml:"version"`
+
+	// Key is the key, in hex or as a Fernet key
+	Key string `yaml:"key"`
+
+	// Created is when the version was created
+	Created time.Time `yaml:"created,omitempty"`
+
+	// Retired is when the version stopped being used for encryption, if it has
+	Retired *time.Time `yaml:"retired,omitempty"`
+}
+
+// ID identifies the version of the key as name@vVersion.
+func (e Entry) ID() string {
+	return fmt.Sprintf("%s@v%d", e.Name, e.Version)
+}
+
+// IsRetired reports whether the version is retired at the given time.
+func (e Entry) IsRetired(now time.Time) bool {
+	return e.Retired != nil && !e.Retired.After(now)
+}
+
+// IsActive reports whether the version is used for encryption at the given time, i.e. created <= now < retired.
+// Versions without a creation time are active from the start, and versions created later can be staged ahead.
+func (e Entry) IsActive(now time.Time) bool {
+	return !e.Created.After(now) && !e.IsRetired(now)
+}
+
+// Keyring holds all versions of all keys.
+type Keyring struct {
+	// Keys lists the key versions
+	Keys []Entry `yaml:"keys"`
+}
+
+// Load reads and validates the keyring file.
+func Load(file string) (*Keyring, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading keyring: %w", err)
+	}
+
+	var keyring Keyring
+
+	if err := yaml.Unmarshal(data, &keyring); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrKeyring, err)
+	}
+
+	if err := keyring.Validate(time.Now()); err != nil {
+		return nil, err
+	}
+
+	return &keyring, nil
+}
+
+// Validate checks that all versions are named, numbered and unique, and that
+// no name has more than one active version at the given time, or when any staged version becomes active.
+func (k *Keyring) Validate(now time.Time) error {
+	seen := make(map[string]bool)
+	instants := []time.Time{now}
+
+	for _, entry := range k.Keys {
+		switch {
+		case entry.Name == "":
+			return fmt.Errorf("%w: key without a name", ErrKeyring)
+		case entry.Version < 1:
+			return fmt.Errorf("%w: key %q has version %d, want 1 or more", ErrKeyring, entry.Name, entry.Version)
+		case entry.Key == "":
+			return fmt.Errorf("%w: key %s is empty", ErrKeyring, entry.ID())
+		case seen[entry.ID()]:
+			return fmt.Errorf("%w: key %s is listed twice", ErrKeyring, entry.ID())
+		case entry.Retired != nil && !entry.Retired.After(entry.Created):
+			return fmt.Errorf("%w: key %s is retired before it is created", ErrKeyring, entry.ID())
+		}
+
+		seen[entry.ID()] = true
+
+		if entry.Created.After(now) {
+			instants = append(instants, entry.Created)
+		}
+	}
+
+	for _, instant := range instants {
+		active := make(map[string]string)
+
+		for _, entry := range k.Keys {
+			if !entry.IsActive(instant) {
+				continue
+			}
+
+			if other, ok := active[entry.Name]; ok {
+				return fmt.Errorf("%w: keys %s and %s are both active at %s, retire one of them",
+					ErrKeyring, other, entry.ID(), instant.Format(time.RFC3339))
+			}
+
+			active[entry.Name] = entry.ID()
+		}
+	}
+
+	return nil
+}
+
+// Names returns the distinct key names, sorted.
+func (k *Keyring) Names() []string {
+	var names []string
+
+	for _, entry := range k.Keys {
+		if !slices.Contains(names, entry.Name) {
+			names = append(names, entry.Name)
+		}
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// Active returns the active version of the named key at the given time.
+// An empty name selects the only key of keyrings with a single name.
+func (k *Keyring) Active(name string, now time.Time) (Entry, error) {
+	if name == "" {
+		names := k.Names()
+		if len(names) != 1 {
+			return Entry{}, fmt.Errorf("%w: select one of the keys %s with --key-name", ErrKeyring, strings.Join(names, ", "))
+		}
+
+		name = names[0]
+	}
+
+	for _, entry := range k.Keys {
+		if entry.Name == name && entry.IsActive(now) {
+			return entry, nil
+		}
+	}
+
+	return Entry{}, fmt.Errorf("%w: no active version of key %q", ErrKeyring, name)
+}
@@ -0,0 +1,69 @@
+package logic
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// writeAtomic replaces the content of file by writing to a temporary file in the same directory
+// and renaming it over the original, keeping its permissions.
+func writeAtomic(file string, content []byte) error {
+	return replaceAtomic(file, func(writer io.Writer) error {
+		_, err := writer.Write(content)
+
+		return err //nolint: wrapcheck
+	})
+}
+
+// replaceAtomic replaces the content of file with the output of write, by writing to a temporary file
+// in the same directory and renaming it over the original, keeping its permissions.
+// If write fails, the file is left untouched.
+func replaceAtomic(file string, write func(io.Writer) error) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return fmt.Errorf("reading file info: %w", err)
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*")
+	if err != nil {
+		return fmt.Errorf("creating temporary file: %w", err)
+	}
+
+	defer os.Remove(temp.Name())
+
+	if err := write(temp); err != nil {
+		temp.Close()
+
+		return fmt.Errorf("writing temporary file: %w", err)
+	}
+
+	if err := temp.Chmod(info.Mode().Perm()); err != nil {
+		temp.Close()
+
+		return fmt.Errorf("setting permissions: %w", err)
+	}
+
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("closing temporary file: %w", err)
+	}
+
+	if err := os.Rename(temp.Name(), file); err != nil {
+		return fmt.Errorf("replacing file: %w", err)
+	}
+
+	return nil
+}
+
+// createPrivate creates a new file readable by the owner only, failing if it already exists.
+func createPrivate(file string) (*os.File, error) {
+	const permissions = 0o600
+
+	created, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, permissions)
+	if err != nil {
+		return nil, fmt.Errorf("creating file: %w", err)
+	}
+
+	return created, nil
+}
@@ -0,0 +1,119 @@
+package logic
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/idelchi/gocry/internal/config"
+	"github.com/idelchi/gocry/internal/encrypt"
+	"github.com/idelchi/gocry/internal/gitcrypt"
+	"github.com/idelchi/gogen/pkg/printer"
+)
+
+// GitCryptFilter is the filter driver that replaces git-crypt in .gitattributes,
+// matching the `encrypt:file` filter documented in the README.
+const GitCryptFilter = "encrypt:file"
+
+// GitCryptImport decrypts the given git-crypt encrypted files with the git-crypt key file,
+// and re-encrypts them in place in gocry's file-mode format with the configured keys.
+// Files not encrypted by git-crypt are skipped.
+// If attributes is not empty, the git-crypt filter entries of that .gitattributes file
+// are rewritten to use GitCryptFilter.
+func GitCryptImport(cfg *config.Config, keyFile, attributes string, files []string) error {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return fmt.Errorf("reading git-crypt key: %w", err)
+	}
+
+	keys, err := gitcrypt.ParseKeyFile(data)
+	if err != nil {
+		return err
+	}
+
+	recipients, identities, err := loadKeys(cfg)
+	if err != nil {
+		return err
+	}
+
+	imported := 0
+
+	for _, file := range files {
+		done, err := importGitCryptFile(cfg, keys, recipients, identities, file)
+		if err != nil {
+			return fmt.Errorf("importing %q: %w", file, err)
+		}
+
+		if done {
+			imported++
+		}
+	}
+
+	printer.Stderrln("imported %d of %d files", imported, len(files))
+
+	if attributes == "" {
+		return nil
+	}
+
+	content, err := os.ReadFile(attributes)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("reading %q: %w", attributes, err)
+	}
+
+	content, changed := gitcrypt.RewriteAttributes(content, GitCryptFilter)
+	if changed == 0 {
+		return nil
+	}
+
+	if err := writeAtomic(attributes, content); err != nil {
+		return err
+	}
+
+	printer.Stderrln("updated %d entries in %q to filter=%s", changed, attributes, GitCryptFilter)
+
+	return nil
+}
+
+// importGitCryptFile re-encrypts a single git-crypt encrypted file in place.
+// It returns false if the file is not encrypted by git-crypt.
+func importGitCryptFile(
+	cfg *config.Config,
+	keys []gitcrypt.Key,
+	recipients []encrypt.Recipient,
+	identities []encrypt.Identity,
+	file string,
+) (bool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return false, fmt.Errorf("reading file: %w", err)
+	}
+
+	if !gitcrypt.IsEncrypted(bufio.NewReader(bytes.NewReader(data))) {
+		printer.Stderrln("skipping %q: not encrypted by git-crypt", file)
+
+		return false, nil
+	}
+
+	plaintext, err := gitcrypt.Decrypt(data, keys)
+	if err != nil {
+		return false, err
+	}
+
+	encryptor := newEncryptor(cfg, recipients, identities, file)
+	encryptor.Operation = encrypt.Encrypt
+	encryptor.Mode = encrypt.File
+	encryptor.Format = encrypt.GoCry
+
+	var ciphertext bytes.Buffer
+	if _, err := encryptor.Process(bytes.NewReader(plaintext), &ciphertext); err != nil {
+		return false, fmt.Errorf("encrypting: %w", err)
+	}
+
+	return true, writeAtomic(file, ciphertext.Bytes())
+}
@@ -0,0 +1,181 @@
+package logic
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+
+	"github.com/idelchi/gocry/internal/config"
+	"github.com/idelchi/gocry/internal/encrypt"
+	"github.com/idelchi/gogen/pkg/key"
+	"github.com/idelchi/gogen/pkg/printer"
+)
+
+// KeyEncoding is the encoding of generated keys.
+type KeyEncoding string
+
+const (
+	// KeyHex encodes keys as 64 hex characters, as accepted by --key and --key-file.
+	KeyHex KeyEncoding = "hex"
+
+	// KeyBase64 encodes keys in url-safe base64, which makes them Fernet keys as well.
+	KeyBase64 KeyEncoding = "base64"
+
+	// KeyRaw writes the 32 bytes of the key as they are, for tools taking raw keys, not for --key-file.
+	KeyRaw KeyEncoding = "raw"
+)
+
+// KeyGenerate generates a random key and writes it to output in the given encoding, or to stdout if empty.
+// Files are created with permissions for the owner only, and must not exist yet.
+func KeyGenerate(output string, encoding KeyEncoding) error {
+	generated, err := key.New(encrypt.KeySize)
+	if err != nil {
+		return fmt.Errorf("generating key: %w", err)
+	}
+
+	var encoded []byte
+
+	switch encoding {
+	case KeyHex:
+		encoded = []byte(generated.AsHex() + "\n")
+	case KeyBase64:
+		encoded = []byte(base64.URLEncoding.EncodeToString(generated) + "\n")
+	case KeyRaw:
+		encoded = generated
+	default:
+		return fmt.Errorf("%w: unknown key encoding %q, want %s, %s or %s", config.ErrUsage, encoding, KeyHex, KeyBase64, KeyRaw)
+	}
+
+	var writer io.Writer = os.Stdout
+
+	if output != "" {
+		file, err := createPrivate(output)
+		if err != nil {
+			return fmt.Errorf("creating key file: %w", err)
+		}
+		defer file.Close()
+
+		writer = file
+	}
+
+	if _, err := writer.Write(encoded); err != nil {
+		return fmt.Errorf("writing key: %w", err)
+	}
+
+	printer.Stderrln("Fingerprint: %s", encrypt.Fingerprint(generated))
+
+	return nil
+}
+
+// KeyFingerprint prints the fingerprint of each key file, as recorded in the header of ciphertext encrypted with it.
+func KeyFingerprint(files []string, passphrase string) error {
+	for _, file := range files {
+		symmetricKey, err := loadKeyFile(file, passphrase)
+		if err != nil {
+			return fmt.Errorf("%q: %w", file, err)
+		}
+
+		printer.Stdoutln("%s  %s", symmetricKey.Fingerprint(), file)
+	}
+
+	return nil
+}
+
+// KeyCheck checks that the key file parses as a key, under the same rules as --key-file, and reports which
+// of the encrypted files under the given paths it decrypts. Files without ciphertext are not reported,
+// and files with legacy lines, which decrypt with any key, are reported as unverifiable.
+// If legacy is set, binary files in no recognized format are taken for legacy AES-CFB ciphertext,
+// and reported as unverifiable as well.
+func KeyCheck(cfg *config.Config, keyFile string, legacy bool, paths []string) error {
+	symmetricKey, err := loadKeyFile(keyFile, cfg.Key.KeyPassphrase)
+	if err != nil {
+		return fmt.Errorf("%q: %w", keyFile, err)
+	}
+
+	printer.Stderrln("valid key: %s", symmetricKey.Fingerprint())
+
+	files, err := walkFiles(paths)
+	if err != nil {
+		return err
+	}
+
+	encrypted, decrypted, unverifiable := 0, 0, 0
+
+	for _, file := range files {
+		isEncrypted, err := checkFile(cfg, symmetricKey, legacy, file)
+
+		switch {
+		case !isEncrypted:
+			continue
+		case errors.Is(err, errLegacy):
+			printer.Stdoutln("unverifiable    %s: %v", file, err)
+
+			unverifiable++
+		case err != nil:
+			printer.Stdoutln("cannot decrypt  %s: %v", file, err)
+		default:
+			printer.Stdoutln("can decrypt     %s", file)
+
+			decrypted++
+		}
+
+		encrypted++
+	}
+
+	if len(paths) > 0 {
+		printer.Stderrln("decrypts %d of %d encrypted files, %d unverifiable (legacy format)", decrypted, encrypted, unverifiable)
+	}
+
+	return nil
+}
+
+// errLegacy reports ciphertext in the legacy AES-CFB format, which decrypts with any key.
+var errLegacy = errors.New("legacy format, decrypts with any key")
+
+// checkFile decrypts the file with the key, discarding the output.
+// It reports whether the file holds ciphertext, in file or line mode, and the error decrypting it,
+// which is errLegacy if it decrypts but holds legacy ciphertext that cannot be verified.
+// Gocry and JWE files are recognized by their format, and binary files in no recognized format
+// are taken for legacy AES-CFB ciphertext if legacy is set, as rekey does.
+func checkFile(cfg *config.Config, symmetricKey *encrypt.SymmetricKey, legacy bool, file string) (bool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return true, fmt.Errorf("reading file: %w", err)
+	}
+
+	decryptor := newEncryptor(cfg, nil, []encrypt.Identity{symmetricKey}, file)
+	decryptor.Operation = encrypt.Decrypt
+
+	format, isCiphertext := encrypt.FileFormat(bufio.NewReader(bytes.NewReader(data)))
+	isLegacy := false
+
+	switch {
+	case isCiphertext && (format == encrypt.GoCry || format == encrypt.JWE):
+		decryptor.Mode = encrypt.File
+	case isCiphertext:
+		return false, nil
+	case bytes.Contains(data, []byte(cfg.Directives.Decrypt+": ")):
+		decryptor.Mode = encrypt.Line
+		isLegacy = decryptor.HasLegacyLines(bytes.NewReader(data))
+	case legacy && !utf8.Valid(data):
+		decryptor.Mode = encrypt.File
+		isLegacy = true
+	default:
+		return false, nil
+	}
+
+	if _, err := decryptor.Process(bytes.NewReader(data), io.Discard); err != nil {
+		return true, err
+	}
+
+	if isLegacy {
+		return true, errLegacy
+	}
+
+	return true, nil
+}
@@ -0,0 +1,43 @@
+package logic
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/idelchi/gocry/internal/encrypt"
+	"github.com/idelchi/gogen/pkg/printer"
+)
+
+// Keygen generates an X25519 identity and writes it to output, or stdout if empty.
+// The matching recipient is printed to stderr.
+func Keygen(output string) error {
+	identity, err := encrypt.GenerateX25519Identity()
+	if err != nil {
+		return err
+	}
+
+	var writer io.Writer = os.Stdout
+
+	if output != "" {
+		file, err := createPrivate(output)
+		if err != nil {
+			return fmt.Errorf("creating identity file: %w", err)
+		}
+		defer file.Close()
+
+		writer = file
+	}
+
+	recipient := identity.Recipient().String()
+
+	if _, err := fmt.Fprintf(writer, "# created: %s\n# public key: %s\n%s\n",
+		time.Now().Format(time.RFC3339), recipient, identity.Encode()); err != nil {
+		return fmt.Errorf("writing identity: %w", err)
+	}
+
+	printer.Stderrln("Public key: %s", recipient)
+
+	return nil
+}
@@ -0,0 +1,448 @@
+package logic
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fernet/fernet-go"
+	"github.com/idelchi/gocry/internal/config"
+	"github.com/idelchi/gocry/internal/encrypt"
+	"github.com/idelchi/gocry/internal/keyring"
+	"github.com/idelchi/gocry/internal/shamir"
+	"github.com/idelchi/gocry/internal/terminal"
+	"github.com/idelchi/gogen/pkg/key"
+)
+
+// loadKeys loads the encryption keys from their providers: hex string, files, keyring and plugin,
+// the X25519 recipients and identities, or the passphrase to derive a key from.
+// Without any of them, the passphrase is prompted for on the terminal.
+// Symmetric keys act both as recipients when encrypting and as identities when decrypting,
+// while X25519 identities also encrypt for their public key.
+func loadKeys(cfg *config.Config) ([]encrypt.Recipient, []encrypt.Identity, error) {
+	providers, err := keyProviders(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		recipients []encrypt.Recipient
+		identities []encrypt.Identity
+	)
+
+	for _, provider := range providers {
+		provided, providedIdentities, err := provider.Keys(cfg.Operation)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		recipients = append(recipients, provided...)
+		identities = append(identities, providedIdentities...)
+	}
+
+	switch {
+	case len(recipients) == 0 && len(identities) == 0:
+		return loadPassphrase(cfg)
+	case cfg.Operation == encrypt.Decrypt && len(identities) == 0:
+		return nil, nil, fmt.Errorf("%w: decryption requires --key, --key-file or --identity, not --recipient", config.ErrUsage)
+	}
+
+	return recipients, identities, nil
+}
+
+// loadX25519Recipients parses the X25519 public keys to encrypt for.
+func loadX25519Recipients(encoded []string) ([]encrypt.Recipient, []encrypt.Identity, error) {
+	recipients := make([]encrypt.Recipient, 0, len(encoded))
+
+	for _, key := range encoded {
+		recipient, err := encrypt.ParseX25519Recipient(key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %w", config.ErrUsage, err)
+		}
+
+		recipients = append(recipients, recipient)
+	}
+
+	return recipients, nil, nil
+}
+
+// loadX25519Identities loads the X25519 private keys from the identity files,
+// which also encrypt for their public key.
+func loadX25519Identities(files []string) ([]encrypt.Recipient, []encrypt.Identity, error) {
+	var (
+		recipients []encrypt.Recipient
+		identities []encrypt.Identity
+	)
+
+	for _, file := range files {
+		data, err := os.Open(filepath.Clean(file))
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading identity file: %w", err)
+		}
+
+		parsed, err := encrypt.ParseX25519Identities(data)
+
+		data.Close()
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading identity file %q: %w", file, err)
+		}
+
+		for _, identity := range parsed {
+			recipients = append(recipients, identity.Recipient())
+			identities = append(identities, identity)
+		}
+	}
+
+	return recipients, identities, nil
+}
+
+// symmetricKeys returns the keys as both recipients and identities.
+func symmetricKeys(keys []*encrypt.SymmetricKey) ([]encrypt.Recipient, []encrypt.Identity) {
+	recipients := make([]encrypt.Recipient, 0, len(keys))
+	identities := make([]encrypt.Identity, 0, len(keys))
+
+	for _, key := range keys {
+		recipients = append(recipients, key)
+		identities = append(identities, key)
+	}
+
+	return recipients, identities
+}
+
+// loadSymmetricKeys loads the keys from string, command output, file descriptor and files,
+// either in hex or as Fernet keys.
+// Key files may also hold shares of a key split with `key split`, which are combined once enough of them are given.
+func loadSymmetricKeys(cfg *config.Config) ([]*encrypt.SymmetricKey, error) {
+	var encodedKeys []string
+
+	if cfg.Key.String != "" {
+		encodedKeys = append(encodedKeys, cfg.Key.String)
+	}
+
+	if cfg.Key.Command != "" {
+		output, err := runKeyCommand(cfg.Key.Command)
+		if err != nil {
+			return nil, err
+		}
+
+		encodedKeys = append(encodedKeys, output)
+	}
+
+	if cfg.Key.FD != 0 {
+		data, err := readKeyFD(cfg.Key.FD)
+		if err != nil {
+			return nil, err
+		}
+
+		encodedKeys = append(encodedKeys, data)
+	}
+
+	rawKeys := make([][]byte, 0, len(encodedKeys)+len(cfg.Key.File))
+
+	for _, encodedKey := range encodedKeys {
+		raw, err := decodeKey(encodedKey)
+		if err != nil {
+			return nil, err
+		}
+
+		rawKeys = append(rawKeys, raw)
+	}
+
+	var shares []shamir.Share
+
+	for _, file := range cfg.Key.File {
+		data, err := readKeyFile(file, cfg.Key.KeyPassphrase)
+		if err != nil {
+			return nil, err
+		}
+
+		if !shamir.IsShare(data) {
+			raw, err := decodeKeyFile(data)
+			if err != nil {
+				return nil, err
+			}
+
+			rawKeys = append(rawKeys, raw)
+
+			continue
+		}
+
+		parsed, err := parseShares(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %w", config.ErrUsage, file, err)
+		}
+
+		shares = append(shares, parsed...)
+	}
+
+	// Keys split into shares are combined in memory only
+	combined, err := combineShares(shares)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", config.ErrUsage, err)
+	}
+
+	keys := make([]*encrypt.SymmetricKey, 0, len(rawKeys)+len(combined))
+
+	for _, raw := range append(rawKeys, combined...) {
+		symmetricKey, err := encrypt.NewSymmetricKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", config.ErrUsage, err)
+		}
+
+		keys = append(keys, symmetricKey)
+	}
+
+	return keys, nil
+}
+
+// runKeyCommand runs the key command with `sh -c`, as git runs credential helpers, and returns its output.
+// The command inherits stderr, to prompt or report errors, but not stdin, which may carry the data.
+func runKeyCommand(command string) (string, error) {
+	if strings.TrimSpace(command) == "" {
+		return "", fmt.Errorf("%w: empty key command", config.ErrUsage)
+	}
+
+	cmd := exec.Command("sh", "-c", command) //nolint: gosec
+	cmd.Stderr = os.Stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("running key command %q: %w", command, err)
+	}
+
+	return string(output), nil
+}
+
+// readKeyFD reads the key from the inherited file descriptor, up to its end.
+func readKeyFD(fd int) (string, error) {
+	file := os.NewFile(uintptr(fd), fmt.Sprintf("fd %d", fd))
+	if file == nil {
+		return "", fmt.Errorf("%w: invalid key file descriptor %d", config.ErrUsage, fd)
+	}
+
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", fmt.Errorf("reading key from file descriptor %d: %w", fd, err)
+	}
+
+	return string(data), nil
+}
+
+// loadKeyring loads the keys of the keyring file, returning the active version of the named key
+// to encrypt with, and all versions of all keys to decrypt with.
+// When decrypting, the active version is only returned if the name selects one.
+func loadKeyring(file, name string, operation encrypt.Operation) (*encrypt.SymmetricKey, []encrypt.Identity, error) {
+	ring, err := keyring.Load(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", config.ErrUsage, err)
+	}
+
+	entry, err := ring.Active(name, time.Now())
+
+	hasActive := err == nil
+	if !hasActive && operation == encrypt.Encrypt {
+		return nil, nil, fmt.Errorf("%w: %w", config.ErrUsage, err)
+	}
+
+	var (
+		active     *encrypt.SymmetricKey
+		identities []encrypt.Identity
+	)
+
+	for _, candidate := range ring.Keys {
+		key, err := parseSymmetricKey(candidate.Key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("keyring key %s: %w", candidate.ID(), err)
+		}
+
+		key.SetName(candidate.ID())
+
+		if hasActive && candidate.ID() == entry.ID() {
+			active = key
+		}
+
+		identities = append(identities, key)
+	}
+
+	return active, identities, nil
+}
+
+// loadKeyFile loads a single key from a file, either in hex or as a Fernet key,
+// protected with the passphrase or not.
+func loadKeyFile(file, passphrase string) (*encrypt.SymmetricKey, error) {
+	raw, err := loadRawKey(file, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	return encrypt.NewSymmetricKey(raw) //nolint: wrapcheck
+}
+
+// loadRawKey loads the raw bytes of a single key from a file, as loadKeyFile does.
+func loadRawKey(file, passphrase string) ([]byte, error) {
+	data, err := readKeyFile(file, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := decodeKeyFile(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := encrypt.NewSymmetricKey(raw); err != nil {
+		return nil, fmt.Errorf("%w: %w", config.ErrUsage, err)
+	}
+
+	return raw, nil
+}
+
+// parseSymmetricKey decodes a key given in hex or as a Fernet key.
+func parseSymmetricKey(encoded string) (*encrypt.SymmetricKey, error) {
+	encryptionKey, err := decodeKey(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	symmetricKey, err := encrypt.NewSymmetricKey(encryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", config.ErrUsage, err)
+	}
+
+	return symmetricKey, nil
+}
+
+// decodeKeyFile decodes the content of a key file in hex or as a Fernet key, as any other key.
+// The 32 raw bytes written by `key generate --encoding raw` are not accepted, as any 32-byte file would pass for a key,
+// and are rejected with a hint.
+func decodeKeyFile(data []byte) ([]byte, error) {
+	raw, err := decodeKey(string(data))
+	if err != nil && len(data) == encrypt.KeySize {
+		return nil, fmt.Errorf("%w: %w; key files of raw bytes are not accepted, write the key in hex", config.ErrUsage, err)
+	}
+
+	return raw, err
+}
+
+// decodeKey decodes a key given in hex or as a base64 Fernet key, ignoring surrounding whitespace.
+func decodeKey(encoded string) ([]byte, error) {
+	if shamir.IsShare([]byte(encoded)) {
+		return nil, fmt.Errorf("%w: got a key share, pass enough share files with --key-file to combine them", config.ErrUsage)
+	}
+
+	encoded = strings.TrimSpace(encoded)
+
+	if len(encoded) == base64.URLEncoding.EncodedLen(len(fernet.Key{})) {
+		fernetKey, err := fernet.DecodeKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("reading Fernet key: %w", err)
+		}
+
+		return fernetKey[:], nil
+	}
+
+	encryptionKey, err := key.FromHex(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("reading key: %w", err)
+	}
+
+	return encryptionKey, nil
+}
+
+// loadPassphrase returns the passphrase to derive a key from,
+// read from the vault password file or prompted for if not configured.
+func loadPassphrase(cfg *config.Config) ([]encrypt.Recipient, []encrypt.Identity, error) {
+	passphrase := []byte(cfg.Key.Passphrase)
+
+	if cfg.Key.VaultPasswordFile != "" {
+		var err error
+		if passphrase, err = readVaultPassword(cfg.Key.VaultPasswordFile); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if len(passphrase) == 0 {
+		var err error
+		if passphrase, err = promptPassphrase(cfg.Operation == encrypt.Encrypt); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	kdf := encrypt.KDFArgon2id
+	if cfg.Key.KDF == encrypt.KDFScrypt.String() {
+		kdf = encrypt.KDFScrypt
+	}
+
+	key := encrypt.NewPassphrase(passphrase, kdf)
+
+	return []encrypt.Recipient{key}, []encrypt.Identity{key}, nil
+}
+
+// promptPassphrase reads the passphrase from the terminal, asking for confirmation if requested.
+func promptPassphrase(confirm bool) ([]byte, error) {
+	passphrase, err := terminal.ReadPassword("Enter passphrase: ")
+
+	switch {
+	case errors.Is(err, terminal.ErrNoTerminal):
+		return nil, fmt.Errorf("%w: missing key: specify either --key, --key-file, --recipient, --identity or --passphrase", config.ErrUsage)
+	case err != nil:
+		return nil, fmt.Errorf("prompting for passphrase: %w", err)
+	}
+
+	if len(passphrase) < config.MinPassphraseLength {
+		return nil, fmt.Errorf("%w: passphrase must be at least %d characters long", config.ErrUsage, config.MinPassphraseLength)
+	}
+
+	if !confirm {
+		return passphrase, nil
+	}
+
+	confirmation, err := terminal.ReadPassword("Confirm passphrase: ")
+	if err != nil {
+		return nil, fmt.Errorf("prompting for passphrase: %w", err)
+	}
+
+	if !bytes.Equal(passphrase, confirmation) {
+		return nil, fmt.Errorf("%w: passphrases do not match", config.ErrUsage)
+	}
+
+	return passphrase, nil
+}
+
+// readVaultPassword reads the Ansible Vault password from file, with trailing whitespace removed.
+// As with ansible-vault, an executable file is run and its output used instead.
+func readVaultPassword(file string) ([]byte, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading vault password file: %w", err)
+	}
+
+	var password []byte
+
+	if info.Mode()&0o111 != 0 {
+		password, err = exec.Command(filepath.Clean(file)).Output()
+	} else {
+		password, err = os.ReadFile(file)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("reading vault password file: %w", err)
+	}
+
+	password = bytes.TrimRight(password, " \t\r\n")
+	if len(password) == 0 {
+		return nil, fmt.Errorf("%w: empty vault password in %q", config.ErrUsage, file)
+	}
+
+	return password, nil
+}
@@ -0,0 +1,194 @@
+package logic
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/idelchi/gocry/internal/encrypt"
+)
+
+// TestLoadKeyFile loads key files in hex and base64, as written by `key generate`, and protected ones,
+// and rejects raw bytes. --key-file and `key check` apply the same rules.
+func TestLoadKeyFile(t *testing.T) {
+	t.Parallel()
+
+	raw := bytes.Repeat([]byte{0x0a, 0xf3}, encrypt.KeySize/2)
+
+	protected, err := encrypt.ProtectKey(raw, []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("ProtectKey: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		content []byte
+		valid   bool
+	}{
+		{name: "hex", content: []byte(hex.EncodeToString(raw) + "\n"), valid: true},
+		{name: "base64", content: []byte(base64.URLEncoding.EncodeToString(raw) + "\n"), valid: true},
+		{name: "protected", content: protected, valid: true},
+		{name: "raw", content: raw},
+		{name: "raw text", content: []byte("correct horse battery staple 32\n")},
+		{name: "short hex", content: []byte(hex.EncodeToString(raw[:encrypt.KeySize/2]))},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			file := filepath.Join(t.TempDir(), "key")
+			if err := os.WriteFile(file, test.content, 0o600); err != nil {
+				t.Fatalf("writing key file: %v", err)
+			}
+
+			key, err := loadKeyFile(file, "correct horse")
+
+			switch {
+			case !test.valid && err == nil:
+				t.Fatalf("loadKeyFile accepted %q", test.content)
+			case test.valid && err != nil:
+				t.Fatalf("loadKeyFile: %v", err)
+			case test.valid && key.Fingerprint() != encrypt.Fingerprint(raw):
+				t.Fatalf("loadKeyFile returned %s, want fingerprint %s", key, encrypt.Fingerprint(raw))
+			}
+
+			cfg := testConfig()
+			cfg.Key.File = []string{file}
+			cfg.Key.KeyPassphrase = "correct horse"
+
+			if _, err := loadSymmetricKeys(cfg); (err == nil) != test.valid {
+				t.Fatalf("--key-file error = %v, want valid %t", err, test.valid)
+			}
+
+			if err := KeyCheck(cfg, file, false, nil); (err == nil) != test.valid {
+				t.Fatalf("KeyCheck error = %v, want valid %t", err, test.valid)
+			}
+		})
+	}
+}
+
+// TestCheckFile recognizes the files key check decrypts, as decryption does.
+func TestCheckFile(t *testing.T) {
+	t.Parallel()
+
+	key, otherKey := testKey(t, 1), testKey(t, 2)
+	plaintext := []byte("password: hunter2\n")
+
+	jwe := testConfig()
+	jwe.Format = encrypt.JWE
+
+	encryptor := newEncryptor(jwe, []encrypt.Recipient{key}, []encrypt.Identity{key}, "secrets.txt")
+	encryptor.Operation = encrypt.Encrypt
+
+	var token bytes.Buffer
+	if _, err := encryptor.Process(bytes.NewReader(plaintext), &token); err != nil {
+		t.Fatalf("encrypting JWE file: %v", err)
+	}
+
+	legacyFile := encryptCFB(t, bytes.Repeat([]byte{1}, encrypt.KeySize), plaintext)
+
+	tests := []struct {
+		name      string
+		content   []byte
+		legacy    bool
+		encrypted bool
+		err       error
+	}{
+		{
+			name:      "gocry",
+			content:   encryptTestData(t, encrypt.File, encrypt.Random, encrypt.AES, plaintext, key),
+			encrypted: true,
+		},
+		{
+			name:      "gocry with another key",
+			content:   encryptTestData(t, encrypt.File, encrypt.Random, encrypt.AES, plaintext, otherKey),
+			encrypted: true,
+			err:       encrypt.ErrWrongKey,
+		},
+		{
+			name:      "lines",
+			content:   encryptTestData(t, encrypt.Line, encrypt.Random, encrypt.AES, []byte("password: hunter2 ### DIRECTIVE: ENCRYPT\n"), key),
+			encrypted: true,
+		},
+		{
+			name:      "jwe",
+			content:   token.Bytes(),
+			encrypted: true,
+		},
+		{
+			name:    "legacy",
+			content: legacyFile,
+		},
+		{
+			name:      "legacy with --legacy",
+			content:   legacyFile,
+			legacy:    true,
+			encrypted: true,
+			err:       errLegacy,
+		},
+		{
+			name:    "plaintext with --legacy",
+			content: plaintext,
+			legacy:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			encrypted, err := checkFile(testConfig(), key, test.legacy, writeTestFile(t, test.content))
+
+			switch {
+			case encrypted != test.encrypted:
+				t.Fatalf("checkFile = %t, want %t", encrypted, test.encrypted)
+			case test.err == nil && err != nil:
+				t.Fatalf("checkFile: %v", err)
+			case !errors.Is(err, test.err):
+				t.Fatalf("checkFile error = %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+// TestRunKeyCommand runs key commands the way a shell one-liner would.
+func TestRunKeyCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("key commands run with sh")
+	}
+
+	t.Parallel()
+
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{command: `printf '%s\n' "prod key"`, want: "prod key\n"},
+		{command: `echo secret | tr a-z A-Z`, want: "SECRET\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.command, func(t *testing.T) {
+			t.Parallel()
+
+			output, err := runKeyCommand(test.command)
+			if err != nil {
+				t.Fatalf("runKeyCommand: %v", err)
+			}
+
+			if output != test.want {
+				t.Fatalf("runKeyCommand = %q, want %q", output, test.want)
+			}
+		})
+	}
+
+	if _, err := runKeyCommand("exit 3"); err == nil {
+		t.Fatal("runKeyCommand accepted a failing command")
+	}
+}
@@ -9,42 +9,16 @@ import (
 	"github.com/idelchi/go-next-tag/pkg/stdin"
 	"github.com/idelchi/gocry/internal/config"
 	"github.com/idelchi/gocry/internal/encrypt"
-	"github.com/idelchi/gogen/pkg/key"
 	"github.com/idelchi/gogen/pkg/printer"
 )
 
 // Run executes the main encryption/decryption logic based on the provided configuration.
 // It handles key loading, input data loading, and processes the data according to the
 // specified mode and operation.
-//
-//nolint:cyclop
 func Run(cfg *config.Config) error {
-	var (
-		encryptionKey []byte
-		err           error
-	)
-
-	// Load encryption key either from hex string or file
-	switch {
-	case cfg.Key.String != "":
-		encryptionKey, err = key.FromHex(cfg.Key.String)
-	case cfg.Key.File != "":
-		encryptionKey, err = os.ReadFile(cfg.Key.File)
-		if err != nil {
-			return fmt.Errorf("reading key file: %w", err)
-		}
-
-		encryptionKey, err = key.FromHex(string(encryptionKey))
-	}
-
+	recipients, identities, err := loadKeys(cfg)
 	if err != nil {
-		return fmt.Errorf("reading key: %w", err)
-	}
-
-	// Ensure key meets AES-256 requirement
-	const keySize = 32
-	if len(encryptionKey) != keySize {
-		return fmt.Errorf("%w: invalid key length: got %d bytes, want %d", config.ErrUsage, len(encryptionKey), keySize)
+		return err
 	}
 
 	// Load input data from stdin or file
@@ -54,14 +28,7 @@ func Run(cfg *config.Config) error {
 	}
 	defer data.Close()
 
-	// Initialize encryptor with configuration
-	encryptor := &encrypt.Encryptor{
-		Key:        encryptionKey,
-		Operation:  cfg.Operation,
-		Mode:       cfg.Mode,
-		Directives: cfg.Directives,
-		Parallel:   cfg.Parallel,
-	}
+	encryptor := newEncryptor(cfg, recipients, identities, cfg.File)
 
 	// Process data and handle any errors
 	processed, err := encryptor.Process(data, os.Stdout)
@@ -81,6 +48,34 @@ func Run(cfg *config.Config) error {
 	return nil
 }
 
+// newEncryptor initializes an encryptor with the configuration and keys, for processing file.
+func newEncryptor(cfg *config.Config, recipients []encrypt.Recipient, identities []encrypt.Identity, file string) *encrypt.Encryptor {
+	// Derive a separate key per file, unless given an explicit context
+	context := cfg.Context
+	if context == "" {
+		context = filepath.ToSlash(filepath.Clean(file))
+	}
+
+	return &encrypt.Encryptor{
+		Recipients:   recipients,
+		Identities:   identities,
+		Operation:    cfg.Operation,
+		Type:         cfg.Type,
+		Cipher:       cfg.Cipher,
+		Format:       cfg.Format,
+		Armor:        cfg.Armor,
+		VaultID:      cfg.VaultID,
+		Iterations:   cfg.Iterations,
+		Digest:       cfg.Digest,
+		JWEAlgorithm: cfg.JWEAlgorithm,
+		TTL:          cfg.TTL,
+		Mode:         cfg.Mode,
+		Directives:   cfg.Directives,
+		Context:      context,
+		Parallel:     cfg.Parallel,
+	}
+}
+
 // loadData returns a file handle for the input data.
 func loadData(file string) (*os.File, error) {
 	if stdin.IsPiped() {
@@ -0,0 +1,109 @@
+package logic
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/tyler-smith/go-bip39"
+	"rsc.io/qr"
+
+	"github.com/idelchi/gocry/internal/config"
+	"github.com/idelchi/gocry/internal/encrypt"
+	"github.com/idelchi/gogen/pkg/key"
+	"github.com/idelchi/gogen/pkg/printer"
+)
+
+// mnemonicWords is the number of words encoding a key, 11 bits each for the 256 bits of the key and 8 bits of checksum.
+const mnemonicWords = 24
+
+// KeyExport prints the key in keyFile as a 24-word BIP39 mnemonic, and, if asked for, as a QR code of the mnemonic.
+func KeyExport(keyFile, passphrase string, qrCode bool) error {
+	raw, err := loadRawKey(keyFile, passphrase)
+	if err != nil {
+		return err
+	}
+
+	mnemonic, err := bip39.NewMnemonic(raw)
+	if err != nil {
+		return fmt.Errorf("encoding mnemonic: %w", err)
+	}
+
+	printer.Stdoutln("%s", mnemonic)
+
+	if qrCode {
+		code, err := qr.Encode(mnemonic, qr.M)
+		if err != nil {
+			return fmt.Errorf("encoding QR code: %w", err)
+		}
+
+		printer.Stdout("%s", renderQR(code))
+	}
+
+	printer.Stderrln("Fingerprint: %s", encrypt.Fingerprint(raw))
+
+	return nil
+}
+
+// KeyImport restores a key from its 24-word mnemonic, read from stdin if words is empty,
+// and writes it in hex to output, or stdout if empty.
+func KeyImport(words []string, output string) error {
+	if len(words) == 0 {
+		input, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("reading mnemonic: %w", err)
+		}
+
+		words = []string{string(input)}
+	}
+
+	fields := strings.Fields(strings.ToLower(strings.Join(words, " ")))
+	if len(fields) != mnemonicWords {
+		return fmt.Errorf("%w: want a mnemonic of %d words, got %d", config.ErrUsage, mnemonicWords, len(fields))
+	}
+
+	raw, err := bip39.EntropyFromMnemonic(strings.Join(fields, " "))
+	if err != nil {
+		return fmt.Errorf("%w: invalid mnemonic: %w", config.ErrUsage, err)
+	}
+
+	printer.Stderrln("Fingerprint: %s", encrypt.Fingerprint(raw))
+
+	encoded := key.Key(raw).AsHex() + "\n"
+
+	if output == "" {
+		_, err := io.WriteString(os.Stdout, encoded)
+
+		return err //nolint: wrapcheck
+	}
+
+	return writePrivate(output, encoded)
+}
+
+// renderQR draws the QR code as text, two rows of modules per line, with the quiet zone around it.
+// Dark modules are drawn as blocks, to be read dark on light, as when printed on paper.
+func renderQR(code *qr.Code) string {
+	const quietZone = 4
+
+	var builder strings.Builder
+
+	for y := -quietZone; y < code.Size+quietZone; y += 2 {
+		for x := -quietZone; x < code.Size+quietZone; x++ {
+			switch top, bottom := code.Black(x, y), code.Black(x, y+1); {
+			case top && bottom:
+				builder.WriteString("█")
+			case top:
+				builder.WriteString("▀")
+			case bottom:
+				builder.WriteString("▄")
+			default:
+				builder.WriteString(" ")
+			}
+		}
+
+		builder.WriteString("\n")
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,120 @@
+package logic
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/idelchi/gocry/internal/config"
+	"github.com/idelchi/gocry/internal/encrypt"
+	"github.com/idelchi/gocry/internal/terminal"
+	"github.com/idelchi/gogen/pkg/key"
+	"github.com/idelchi/gogen/pkg/printer"
+)
+
+// readKeyFile reads the content of a key file, decrypting it if protected with a passphrase.
+// The key of a protected key file is returned in hex, as in an unprotected key file.
+// Without a passphrase, it is prompted for on the terminal.
+func readKeyFile(file, passphrase string) ([]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading key file: %w", err)
+	}
+
+	if !encrypt.IsProtectedKey(data) {
+		return data, nil
+	}
+
+	secret := []byte(passphrase)
+
+	if len(secret) == 0 {
+		secret, err = terminal.ReadPassword(fmt.Sprintf("Enter passphrase for key file %q: ", file))
+
+		switch {
+		case errors.Is(err, terminal.ErrNoTerminal):
+			return nil, fmt.Errorf("%w: key file %q is protected with a passphrase, specify --key-passphrase", config.ErrUsage, file)
+		case err != nil:
+			return nil, fmt.Errorf("prompting for passphrase: %w", err)
+		}
+	}
+
+	raw, err := encrypt.UnprotectKey(data, secret)
+
+	switch {
+	case errors.Is(err, encrypt.ErrWrongKey):
+		return nil, fmt.Errorf("%w: wrong passphrase for key file %q", encrypt.ErrWrongKey, file)
+	case err != nil:
+		return nil, fmt.Errorf("decrypting key file %q: %w", file, err)
+	}
+
+	return []byte(key.Key(raw).AsHex()), nil
+}
+
+// KeyPassphrase protects the key file with the new passphrase, replacing its current one if any,
+// or removes the protection, leaving the key in hex. The file is replaced atomically.
+// The current passphrase is prompted for if needed and not given, and the new one if not given.
+func KeyPassphrase(keyFile, passphrase, newPassphrase string, remove bool) error {
+	raw, err := loadRawKey(keyFile, passphrase)
+	if err != nil {
+		return err
+	}
+
+	if remove {
+		if err := writeAtomic(keyFile, []byte(key.Key(raw).AsHex()+"\n")); err != nil {
+			return err
+		}
+
+		printer.Stderrln("removed the passphrase of key file %q", keyFile)
+
+		return nil
+	}
+
+	secret := []byte(newPassphrase)
+
+	if len(secret) == 0 {
+		if secret, err = promptNewPassphrase(); err != nil {
+			return err
+		}
+	}
+
+	if len(secret) < config.MinPassphraseLength {
+		return fmt.Errorf("%w: passphrase must be at least %d characters long", config.ErrUsage, config.MinPassphraseLength)
+	}
+
+	protected, err := encrypt.ProtectKey(raw, secret)
+	if err != nil {
+		return fmt.Errorf("protecting key: %w", err)
+	}
+
+	if err := writeAtomic(keyFile, protected); err != nil {
+		return err
+	}
+
+	printer.Stderrln("protected key file %q with a passphrase", keyFile)
+
+	return nil
+}
+
+// promptNewPassphrase reads a new passphrase from the terminal, asking for confirmation.
+func promptNewPassphrase() ([]byte, error) {
+	passphrase, err := terminal.ReadPassword("Enter new passphrase: ")
+
+	switch {
+	case errors.Is(err, terminal.ErrNoTerminal):
+		return nil, fmt.Errorf("%w: missing new passphrase: specify --new-key-passphrase", config.ErrUsage)
+	case err != nil:
+		return nil, fmt.Errorf("prompting for passphrase: %w", err)
+	}
+
+	confirmation, err := terminal.ReadPassword("Confirm new passphrase: ")
+	if err != nil {
+		return nil, fmt.Errorf("prompting for passphrase: %w", err)
+	}
+
+	if !bytes.Equal(passphrase, confirmation) {
+		return nil, fmt.Errorf("%w: passphrases do not match", config.ErrUsage)
+	}
+
+	return passphrase, nil
+}
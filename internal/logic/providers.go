@@ -0,0 +1,162 @@
+package logic
+
+import (
+	"fmt"
+
+	"github.com/idelchi/gocry/internal/config"
+	"github.com/idelchi/gocry/internal/encrypt"
+	"github.com/idelchi/gocry/internal/plugin"
+)
+
+// KeyProvider provides the keys to encrypt for and to decrypt with.
+type KeyProvider interface {
+	// Keys returns the recipients and identities for the operation.
+	Keys(operation encrypt.Operation) ([]encrypt.Recipient, []encrypt.Identity, error)
+}
+
+// KeyProviderFunc adapts a function to a KeyProvider.
+type KeyProviderFunc func(operation encrypt.Operation) ([]encrypt.Recipient, []encrypt.Identity, error)
+
+// Keys calls the function.
+func (f KeyProviderFunc) Keys(operation encrypt.Operation) ([]encrypt.Recipient, []encrypt.Identity, error) {
+	return f(operation)
+}
+
+// keyProviders returns the providers of the keys configured, in the order their keys are used.
+func keyProviders(cfg *config.Config) ([]KeyProvider, error) {
+	var providers []KeyProvider
+
+	if cfg.Key.String != "" || cfg.Key.Command != "" || cfg.Key.FD != 0 || len(cfg.Key.File) > 0 {
+		providers = append(providers, KeyProviderFunc(func(encrypt.Operation) ([]encrypt.Recipient, []encrypt.Identity, error) {
+			keys, err := loadSymmetricKeys(cfg)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			recipients, identities := symmetricKeys(keys)
+
+			return recipients, identities, nil
+		}))
+	}
+
+	if cfg.Key.Keyring != "" {
+		providers = append(providers, KeyProviderFunc(func(operation encrypt.Operation) ([]encrypt.Recipient, []encrypt.Identity, error) {
+			active, all, err := loadKeyring(cfg.Key.Keyring, cfg.Key.KeyName, operation)
+
+			switch {
+			case err != nil:
+				return nil, nil, err
+			case active == nil:
+				return nil, all, nil
+			}
+
+			return []encrypt.Recipient{active}, all, nil
+		}))
+	}
+
+	if cfg.Key.Provider != "" {
+		name, argument, err := plugin.Parse(cfg.Key.Provider)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", config.ErrUsage, err)
+		}
+
+		providers = append(providers, pluginProvider{name: name, argument: argument})
+	}
+
+	if len(cfg.Key.Recipients) > 0 {
+		providers = append(providers, KeyProviderFunc(func(encrypt.Operation) ([]encrypt.Recipient, []encrypt.Identity, error) {
+			return loadX25519Recipients(cfg.Key.Recipients)
+		}))
+	}
+
+	if len(cfg.Key.Identities) > 0 {
+		providers = append(providers, KeyProviderFunc(func(encrypt.Operation) ([]encrypt.Recipient, []encrypt.Identity, error) {
+			return loadX25519Identities(cfg.Key.Identities)
+		}))
+	}
+
+	return providers, nil
+}
+
+// pluginProvider provides the keys returned by a key provider plugin,
+// or the plugin itself as the key, if it wraps data keys itself.
+type pluginProvider struct {
+	name     string
+	argument string
+}
+
+// String returns the provider as name:argument, as recorded in the stanzas wrapped by the plugin.
+func (p pluginProvider) String() string {
+	if p.argument == "" {
+		return p.name
+	}
+
+	return p.name + ":" + p.argument
+}
+
+// Keys runs the plugin and parses the keys it returns, which act as symmetric keys.
+func (p pluginProvider) Keys(operation encrypt.Operation) ([]encrypt.Recipient, []encrypt.Identity, error) {
+	response, err := plugin.Run(p.name, plugin.Request{
+		Version:   plugin.Version,
+		Operation: string(operation),
+		Argument:  p.argument,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if response.Wrap {
+		key := encrypt.NewPluginKey(p.String(), p)
+
+		return []encrypt.Recipient{key}, []encrypt.Identity{key}, nil
+	}
+
+	keys := make([]*encrypt.SymmetricKey, 0, len(response.Keys))
+
+	for _, key := range response.Keys {
+		symmetricKey, err := parseSymmetricKey(key.Key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("key from %s%s: %w", plugin.Prefix, p.name, err)
+		}
+
+		if key.Name != "" {
+			symmetricKey.SetName(key.Name)
+		}
+
+		keys = append(keys, symmetricKey)
+	}
+
+	recipients, identities := symmetricKeys(keys)
+
+	return recipients, identities, nil
+}
+
+// WrapKey runs the plugin to wrap the data key.
+func (p pluginProvider) WrapKey(dataKey []byte) ([]byte, error) {
+	response, err := plugin.Run(p.name, plugin.Request{
+		Version:   plugin.Version,
+		Operation: plugin.Wrap,
+		Argument:  p.argument,
+		DataKey:   dataKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return response.WrappedKey, nil
+}
+
+// UnwrapKey runs the plugin to unwrap the wrapped key.
+func (p pluginProvider) UnwrapKey(wrappedKey []byte) ([]byte, error) {
+	response, err := plugin.Run(p.name, plugin.Request{
+		Version:    plugin.Version,
+		Operation:  plugin.Unwrap,
+		Argument:   p.argument,
+		WrappedKey: wrappedKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return response.DataKey, nil
+}
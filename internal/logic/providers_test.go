@@ -0,0 +1,117 @@
+package logic
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/idelchi/gocry/internal/config"
+	"github.com/idelchi/gocry/internal/encrypt"
+	"github.com/idelchi/gocry/internal/plugin/plugintest"
+)
+
+// TestLoadKeysPlugin loads the keys of a fake plugin selected with --key-provider fake:arg.
+func TestLoadKeysPlugin(t *testing.T) {
+	const encoded = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+	request := plugintest.Install(t, "fake", `echo '{"keys": [{"name": "fake@v1", "key": "`+encoded+`"}]}'`)
+
+	cfg := &config.Config{Operation: encrypt.Encrypt}
+	cfg.Key.Provider = "fake:arg"
+
+	recipients, identities, err := loadKeys(cfg)
+	if err != nil {
+		t.Fatalf("loadKeys: %v", err)
+	}
+
+	if len(recipients) != 1 || len(identities) != 1 {
+		t.Fatalf("loadKeys returned %d recipients and %d identities, want 1 of each", len(recipients), len(identities))
+	}
+
+	raw, err := hex.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("decoding key: %v", err)
+	}
+
+	key, ok := recipients[0].(*encrypt.SymmetricKey)
+
+	switch {
+	case !ok:
+		t.Fatalf("loadKeys returned %T, want a symmetric key", recipients[0])
+	case key.Fingerprint() != encrypt.Fingerprint(raw):
+		t.Fatalf("loadKeys returned %s, want fingerprint %s", key, encrypt.Fingerprint(raw))
+	case !strings.Contains(key.String(), "fake@v1"):
+		t.Fatalf("loadKeys returned %s, want it named fake@v1", key)
+	}
+
+	data, err := os.ReadFile(request)
+	if err != nil {
+		t.Fatalf("reading request: %v", err)
+	}
+
+	if want := `{"version":1,"operation":"encrypt","argument":"arg"}`; string(data) != want {
+		t.Fatalf("plugin received %s, want %s", data, want)
+	}
+}
+
+// wrappingPlugin is a fake plugin which wraps data keys itself, as a key management service would.
+// It wraps by rotating the base64 alphabet of the encoded key by half, which is its own inverse.
+const wrappingPlugin = `request=$(cat "$(dirname "$0")/request.json")
+field() { printf '%s' "$request" | sed -n 's/.*"'"$1"'":"\([^"]*\)".*/\1/p' | tr 'A-Za-fg-z0-9+/' 'g-z0-9+/A-Za-f'; }
+case $request in
+*'"operation":"wrap"'*) printf '{"wrapped_key": "%s"}\n' "$(field data_key)" ;;
+*'"operation":"unwrap"'*) printf '{"data_key": "%s"}\n' "$(field wrapped_key)" ;;
+*) echo '{"wrap": true}' ;;
+esac`
+
+// TestPluginWrap encrypts with a plugin wrapping the data key itself, and decrypts by having it unwrap the key.
+func TestPluginWrap(t *testing.T) {
+	plugintest.Install(t, "kms", wrappingPlugin)
+
+	plaintext := []byte("password: hunter2\n")
+
+	// process encrypts or decrypts the input with the keys of the provider.
+	process := func(operation encrypt.Operation, provider string, input []byte) ([]byte, error) {
+		cfg := testConfig()
+		cfg.Operation = operation
+		cfg.Key.Provider = provider
+
+		recipients, identities, err := loadKeys(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		encryptor := newEncryptor(cfg, recipients, identities, "secrets.txt")
+		encryptor.Operation = operation
+
+		var output bytes.Buffer
+		_, err = encryptor.Process(bytes.NewReader(input), &output)
+
+		return output.Bytes(), err
+	}
+
+	ciphertext, err := process(encrypt.Encrypt, "kms:prod", plaintext)
+
+	switch {
+	case err != nil:
+		t.Fatalf("encrypting: %v", err)
+	case !bytes.Contains(ciphertext, []byte("kms:prod")):
+		t.Fatalf("ciphertext %q does not record the provider", ciphertext)
+	}
+
+	decrypted, err := process(encrypt.Decrypt, "kms:prod", ciphertext)
+
+	switch {
+	case err != nil:
+		t.Fatalf("decrypting: %v", err)
+	case !bytes.Equal(decrypted, plaintext):
+		t.Fatalf("decrypted %q, want %q", decrypted, plaintext)
+	}
+
+	if _, err := process(encrypt.Decrypt, "kms:staging", ciphertext); !errors.Is(err, encrypt.ErrWrongKey) {
+		t.Fatalf("decrypting with another provider: error = %v, want %v", err, encrypt.ErrWrongKey)
+	}
+}
@@ -0,0 +1,263 @@
+package logic
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+
+	"github.com/idelchi/gocry/internal/config"
+	"github.com/idelchi/gocry/internal/encrypt"
+	"github.com/idelchi/gogen/pkg/printer"
+)
+
+// rekeyed describes how a file was rotated to the new key.
+type rekeyed struct {
+	// rewrapped is set if only the header of file-mode ciphertext was rewritten
+	rewrapped bool
+
+	// reencrypted is set if file-mode ciphertext was re-encrypted as a whole
+	reencrypted bool
+
+	// rotated is set if file-mode ciphertext already decrypts with the new key
+	rotated bool
+
+	// lines is the number of encrypted lines re-encrypted
+	lines int
+
+	// rotatedLines is the number of encrypted lines that already decrypt with the new key
+	rotatedLines int
+
+	// unsupported is the format of file-mode ciphertext that cannot be rotated with keys, if any
+	unsupported encrypt.Format
+}
+
+// ErrNotRotated indicates encrypted files that rekey cannot rotate to the new key.
+var ErrNotRotated = errors.New("files not rotated")
+
+// Rekey rotates the files under the given paths from the key in oldKeyFile to the key in newKeyFile.
+// Directories are walked recursively, skipping .git directories.
+// File-mode ciphertext gets its data key rewrapped in a new header, leaving the payload untouched,
+// unless reencrypt is set or the ciphertext cannot be rewrapped, in which case it is re-encrypted as a whole,
+// keeping its cipher suite.
+// JWE files are re-encrypted as a whole as well, and so are binary files in no recognized format if legacy is set,
+// taking them for ciphertext in the legacy AES-CFB format, which has nothing to recognize it by.
+// In other files, only the encrypted lines are re-encrypted.
+// Other recipients keep their access, and ciphertext that cannot be re-encrypted without dropping them is an error.
+// Files and lines that already decrypt with the new key, as after an interrupted run, are skipped,
+// as are files without ciphertext. Each file is replaced atomically.
+// Files in formats keyed by passphrases or X25519 identities (age, Ansible Vault and OpenSSL) are left as they are,
+// and reported with ErrNotRotated once all other files are rotated.
+func Rekey(cfg *config.Config, oldKeyFile, newKeyFile string, reencrypt, legacy bool, paths []string) error {
+	oldKey, err := loadKeyFile(oldKeyFile, cfg.Key.KeyPassphrase)
+	if err != nil {
+		return fmt.Errorf("loading old key: %w", err)
+	}
+
+	newKey, err := loadKeyFile(newKeyFile, cfg.Key.KeyPassphrase)
+	if err != nil {
+		return fmt.Errorf("loading new key: %w", err)
+	}
+
+	files, err := walkFiles(paths)
+	if err != nil {
+		return err
+	}
+
+	var rewrapped, reencrypted, rotated, lines, lineFiles, rotatedLines, unsupported int
+
+	for _, file := range files {
+		result, err := rekeyFile(cfg, oldKey, newKey, reencrypt, legacy, file)
+		if err != nil {
+			return fmt.Errorf("rekeying %q: %w", file, err)
+		}
+
+		switch {
+		case result.unsupported != "":
+			printer.Stderrln("cannot rotate %s file with keys, left as is: %q", result.unsupported, file)
+
+			unsupported++
+		case result.rewrapped:
+			printer.Stderrln("rewrapped file: %q", file)
+
+			rewrapped++
+		case result.reencrypted:
+			printer.Stderrln("re-encrypted file: %q", file)
+
+			reencrypted++
+		case result.rotated:
+			printer.Stderrln("already rotated file: %q", file)
+
+			rotated++
+		case result.lines > 0:
+			printer.Stderrln("re-encrypted %d lines in: %q", result.lines, file)
+
+			lines += result.lines
+			lineFiles++
+		}
+
+		rotatedLines += result.rotatedLines
+	}
+
+	printer.Stderrln("rotated %d files (%d rewrapped, %d re-encrypted) and %d lines in %d files, of %d files scanned",
+		rewrapped+reencrypted, rewrapped, reencrypted, lines, lineFiles, len(files))
+
+	if rotated > 0 || rotatedLines > 0 {
+		printer.Stderrln("skipped %d files and %d lines already rotated", rotated, rotatedLines)
+	}
+
+	if unsupported > 0 {
+		return fmt.Errorf("%w: %d files in formats rekey cannot rotate, listed above, still use the old key",
+			ErrNotRotated, unsupported)
+	}
+
+	return nil
+}
+
+// walkFiles expands the paths into the regular files they contain, skipping .git directories.
+func walkFiles(paths []string) ([]string, error) {
+	var files []string
+
+	for _, path := range paths {
+		err := filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			switch {
+			case err != nil:
+				return err
+			case entry.IsDir() && entry.Name() == ".git":
+				return filepath.SkipDir
+			case entry.Type().IsRegular():
+				files = append(files, file)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("walking %q: %w", path, err)
+		}
+	}
+
+	return files, nil
+}
+
+// rekeyFile rotates a single file to the new key.
+func rekeyFile(cfg *config.Config, oldKey, newKey *encrypt.SymmetricKey, reencrypt, legacy bool, file string) (rekeyed, error) {
+	decryptor := newEncryptor(cfg, nil, []encrypt.Identity{oldKey}, file)
+	decryptor.Operation = encrypt.Decrypt
+
+	encryptor := newEncryptor(cfg, []encrypt.Recipient{newKey}, []encrypt.Identity{newKey}, file)
+	encryptor.Operation = encrypt.Encrypt
+
+	format, isCiphertext, err := fileFormat(file)
+	if err != nil {
+		return rekeyed{}, err
+	}
+
+	if isCiphertext && format != encrypt.GoCry && format != encrypt.JWE {
+		return rekeyed{unsupported: format}, nil
+	}
+
+	if format == encrypt.GoCry && !reencrypt {
+		// Rewrapping streams the file, so that large payloads are never held in memory.
+		err := replaceAtomic(file, func(writer io.Writer) error {
+			return rewrapFile(decryptor, encryptor, file, writer)
+		})
+
+		switch {
+		case err == nil:
+			return rekeyed{rewrapped: true}, nil
+		case errors.Is(err, encrypt.ErrWrongKey) && isRotated(cfg, newKey, file):
+			return rekeyed{rotated: true}, nil
+		case !errors.Is(err, encrypt.ErrRewrap):
+			return rekeyed{}, err
+		}
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return rekeyed{}, fmt.Errorf("reading file: %w", err)
+	}
+
+	switch {
+	case isCiphertext:
+	case bytes.Contains(data, []byte(cfg.Directives.Decrypt+": ")):
+		return rekeyLines(decryptor, encryptor, file, data)
+	case !legacy || utf8.Valid(data):
+		return rekeyed{}, nil
+	}
+
+	var ciphertext bytes.Buffer
+
+	err = decryptor.Reencrypt(bytes.NewReader(data), &ciphertext, encryptor)
+
+	// JWE does not identify its key, so a wrong key shows as an authentication failure.
+	switch {
+	case (errors.Is(err, encrypt.ErrWrongKey) || errors.Is(err, encrypt.ErrAuthentication)) && isRotated(cfg, newKey, file):
+		return rekeyed{rotated: true}, nil
+	case err != nil:
+		return rekeyed{}, fmt.Errorf("re-encrypting: %w", err)
+	}
+
+	return rekeyed{reencrypted: true}, writeAtomic(file, ciphertext.Bytes())
+}
+
+// rekeyLines re-encrypts the encrypted lines in data, the content of file.
+func rekeyLines(decryptor, encryptor *encrypt.Encryptor, file string, data []byte) (rekeyed, error) {
+	var output bytes.Buffer
+
+	lines, rotatedLines, err := decryptor.RekeyLines(bytes.NewReader(data), &output, encryptor)
+	if err != nil {
+		return rekeyed{}, fmt.Errorf("rekeying lines: %w", err)
+	}
+
+	if lines == 0 {
+		return rekeyed{rotatedLines: rotatedLines}, nil
+	}
+
+	return rekeyed{lines: lines, rotatedLines: rotatedLines}, writeAtomic(file, output.Bytes())
+}
+
+// isRotated reports whether the file-mode ciphertext in file already decrypts with the new key.
+func isRotated(cfg *config.Config, newKey *encrypt.SymmetricKey, file string) bool {
+	input, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return false
+	}
+	defer input.Close()
+
+	decryptor := newEncryptor(cfg, nil, []encrypt.Identity{newKey}, file)
+	decryptor.Operation = encrypt.Decrypt
+	decryptor.Mode = encrypt.File
+
+	_, err = decryptor.Process(input, io.Discard)
+
+	return err == nil
+}
+
+// fileFormat returns the format of the file-mode ciphertext file starts with, if any.
+func fileFormat(file string) (encrypt.Format, bool, error) {
+	input, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return "", false, fmt.Errorf("opening file: %w", err)
+	}
+	defer input.Close()
+
+	format, ok := encrypt.FileFormat(bufio.NewReader(input))
+
+	return format, ok, nil
+}
+
+// rewrapFile rewraps the data key of the file-mode ciphertext in file for the recipients of encryptor.
+func rewrapFile(decryptor, encryptor *encrypt.Encryptor, file string, writer io.Writer) error {
+	input, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return fmt.Errorf("opening file: %w", err)
+	}
+	defer input.Close()
+
+	return decryptor.Rewrap(input, writer, encryptor) //nolint: wrapcheck
+}
@@ -0,0 +1,335 @@
+package logic
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/idelchi/gocry/internal/config"
+	"github.com/idelchi/gocry/internal/encrypt"
+)
+
+// testConfig returns the configuration of a run with the default flags.
+func testConfig() *config.Config {
+	return &config.Config{
+		Parallel:     1,
+		Mode:         encrypt.File,
+		Format:       encrypt.GoCry,
+		JWEAlgorithm: encrypt.JWEDirect,
+		Type:         encrypt.Random,
+		Cipher:       encrypt.AES,
+		Directives:   encrypt.Directives{Encrypt: "### DIRECTIVE: ENCRYPT", Decrypt: "### DIRECTIVE: DECRYPT"},
+	}
+}
+
+// testKey returns a symmetric key of repeated bytes.
+func testKey(t *testing.T, b byte) *encrypt.SymmetricKey {
+	t.Helper()
+
+	key, err := encrypt.NewSymmetricKey(bytes.Repeat([]byte{b}, encrypt.KeySize))
+	if err != nil {
+		t.Fatalf("NewSymmetricKey: %v", err)
+	}
+
+	return key
+}
+
+// writeTestFile writes content to a new file in a temporary directory and returns its path.
+func writeTestFile(t *testing.T, content []byte) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "secrets.txt")
+	if err := os.WriteFile(file, content, 0o600); err != nil {
+		t.Fatalf("writing file: %v", err)
+	}
+
+	return file
+}
+
+// decryptTestFile decrypts file with the key in the given mode.
+func decryptTestFile(t *testing.T, key *encrypt.SymmetricKey, mode encrypt.Mode, file string) []byte {
+	t.Helper()
+
+	input, err := os.Open(file)
+	if err != nil {
+		t.Fatalf("opening file: %v", err)
+	}
+	defer input.Close()
+
+	cfg := testConfig()
+	cfg.Mode = mode
+
+	decryptor := newEncryptor(cfg, nil, []encrypt.Identity{key}, file)
+	decryptor.Operation = encrypt.Decrypt
+
+	var plaintext bytes.Buffer
+	if _, err := decryptor.Process(input, &plaintext); err != nil {
+		t.Fatalf("decrypting with %s: %v", key, err)
+	}
+
+	return plaintext.Bytes()
+}
+
+// encryptTestData encrypts plaintext for the keys in the given mode, type and cipher.
+func encryptTestData(
+	t *testing.T,
+	mode encrypt.Mode,
+	kind encrypt.Type,
+	cipher encrypt.Cipher,
+	plaintext []byte,
+	keys ...*encrypt.SymmetricKey,
+) []byte {
+	t.Helper()
+
+	cfg := testConfig()
+	cfg.Mode, cfg.Type, cfg.Cipher = mode, kind, cipher
+
+	recipients := make([]encrypt.Recipient, len(keys))
+	for i, key := range keys {
+		recipients[i] = key
+	}
+
+	encryptor := newEncryptor(cfg, recipients, nil, "secrets.txt")
+	encryptor.Operation = encrypt.Encrypt
+
+	var ciphertext bytes.Buffer
+	if _, err := encryptor.Process(bytes.NewReader(plaintext), &ciphertext); err != nil {
+		t.Fatalf("encrypting: %v", err)
+	}
+
+	return ciphertext.Bytes()
+}
+
+// encryptCFB encrypts plaintext in the AES-CFB file format written by the first versions of gocry.
+func encryptCFB(t *testing.T, key, plaintext []byte) []byte {
+	t.Helper()
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatalf("creating cipher: %v", err)
+	}
+
+	ciphertext := make([]byte, aes.BlockSize+len(plaintext))
+	if _, err := io.ReadFull(rand.Reader, ciphertext[:aes.BlockSize]); err != nil {
+		t.Fatalf("generating IV: %v", err)
+	}
+
+	cipher.NewCFBEncrypter(block, ciphertext[:aes.BlockSize]).XORKeyStream(ciphertext[aes.BlockSize:], plaintext)
+
+	return ciphertext
+}
+
+// TestRekeyFileLegacy rekeys a file encrypted in the AES-CFB format of the first versions, when asked to.
+func TestRekeyFileLegacy(t *testing.T) {
+	t.Parallel()
+
+	oldKey, newKey := testKey(t, 1), testKey(t, 2)
+	plaintext := []byte("password: hunter2\n")
+
+	file := writeTestFile(t, encryptCFB(t, bytes.Repeat([]byte{1}, encrypt.KeySize), plaintext))
+
+	result, err := rekeyFile(testConfig(), oldKey, newKey, false, true, file)
+	if err != nil {
+		t.Fatalf("rekeyFile: %v", err)
+	}
+
+	if result != (rekeyed{reencrypted: true}) {
+		t.Fatalf("rekeyFile = %+v, want the file re-encrypted", result)
+	}
+
+	if decrypted := decryptTestFile(t, newKey, encrypt.File, file); !bytes.Equal(decrypted, plaintext) {
+		t.Fatalf("decrypted %q, want %q", decrypted, plaintext)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("reading file: %v", err)
+	}
+
+	if !bytes.HasPrefix(data, []byte("GOCRY")) {
+		t.Fatalf("rekeyed file starts with %q, want the current format", data[:5])
+	}
+}
+
+// TestRekeyFileUnsupported reports files in formats keyed by passphrases, leaving them as they are.
+func TestRekeyFileUnsupported(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		format  encrypt.Format
+		content string
+	}{
+		{format: encrypt.OpenSSL, content: "Salted__\x01\x02\x03\x04\x05\x06\x07\x08\x8f\x13\xa9\x00"},
+		{format: encrypt.AnsibleVault, content: "$ANSIBLE_VAULT;1.1;AES256\n6162\n"},
+		{format: encrypt.Age, content: "age-encryption.org/v1\n-> scrypt c2FsdA 18\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.format), func(t *testing.T) {
+			t.Parallel()
+
+			file := writeTestFile(t, []byte(test.content))
+
+			result, err := rekeyFile(testConfig(), testKey(t, 1), testKey(t, 2), false, false, file)
+			if err != nil {
+				t.Fatalf("rekeyFile: %v", err)
+			}
+
+			if result != (rekeyed{unsupported: test.format}) {
+				t.Fatalf("rekeyFile = %+v, want the %s format reported", result, test.format)
+			}
+
+			if data, _ := os.ReadFile(file); string(data) != test.content {
+				t.Fatalf("rekeyFile changed the file to %q", data)
+			}
+		})
+	}
+}
+
+// TestRekeyFile rotates files from an old to a new key, and skips them on a second run.
+func TestRekeyFile(t *testing.T) {
+	t.Parallel()
+
+	oldKey, newKey, otherKey := testKey(t, 1), testKey(t, 2), testKey(t, 3)
+	plaintext := []byte("user: admin\r\npassword: hunter2\r\n")
+	lines := []byte("user: admin\npassword: hunter2 ### DIRECTIVE: ENCRYPT\nport: 22\n")
+
+	// Line mode writes LF, so the CRLF endings of a file checked out on Windows are put back afterwards.
+	crlf := bytes.ReplaceAll(encryptTestData(t, encrypt.Line, encrypt.Random, encrypt.AES, lines, oldKey),
+		[]byte("\n"), []byte("\r\n"))
+
+	tests := []struct {
+		name      string
+		content   []byte
+		mode      encrypt.Mode
+		reencrypt bool
+		want      rekeyed
+		others    []*encrypt.SymmetricKey
+		rotated   []byte
+	}{
+		{
+			name:    "rewrap",
+			content: encryptTestData(t, encrypt.File, encrypt.Random, encrypt.AES, plaintext, oldKey),
+			want:    rekeyed{rewrapped: true},
+		},
+		{
+			name:    "multiple recipients",
+			content: encryptTestData(t, encrypt.File, encrypt.Random, encrypt.AES, plaintext, otherKey, oldKey),
+			want:    rekeyed{rewrapped: true},
+			others:  []*encrypt.SymmetricKey{otherKey},
+		},
+		{
+			// The data key of deterministic ciphertext is derived from the key, so it cannot be rewrapped.
+			// It is re-encrypted with the context it was encrypted with, not the path of the temporary file.
+			name:    "deterministic",
+			content: encryptTestData(t, encrypt.File, encrypt.Deterministic, encrypt.AES, plaintext, oldKey),
+			want:    rekeyed{reencrypted: true},
+			rotated: encryptTestData(t, encrypt.File, encrypt.Deterministic, encrypt.AES, plaintext, newKey),
+		},
+		{
+			name:    "xchacha20-poly1305",
+			content: encryptTestData(t, encrypt.File, encrypt.Random, encrypt.XChaCha20, plaintext, oldKey),
+			want:    rekeyed{rewrapped: true},
+		},
+		{
+			name:      "re-encrypt",
+			content:   encryptTestData(t, encrypt.File, encrypt.Random, encrypt.XChaCha20, plaintext, oldKey),
+			reencrypt: true,
+			want:      rekeyed{reencrypted: true},
+		},
+		{
+			name:    "crlf lines",
+			content: crlf,
+			mode:    encrypt.Line,
+			want:    rekeyed{lines: 1},
+		},
+		{
+			name:    "plaintext",
+			content: lines,
+		},
+		{
+			name:    "binary",
+			content: []byte{0x00, 0xff, 0x10, 0x80, 0xc3},
+		},
+		{
+			// Binary files as long as an AES-CFB IV, or longer, are not taken for legacy ciphertext without --legacy.
+			name:    "binary block",
+			content: []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"),
+		},
+		{
+			// The last byte decrypts to a newline with the old key, as legacy ciphertext of text would.
+			name:    "binary decrypting to text",
+			content: []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\xbc"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := testConfig()
+			if test.mode != "" {
+				cfg.Mode = test.mode
+			}
+
+			file := writeTestFile(t, test.content)
+
+			result, err := rekeyFile(cfg, oldKey, newKey, test.reencrypt, false, file)
+
+			switch {
+			case err != nil:
+				t.Fatalf("rekeyFile: %v", err)
+			case result != test.want:
+				t.Fatalf("rekeyFile = %+v, want %+v", result, test.want)
+			}
+
+			rotated, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("reading file: %v", err)
+			}
+
+			switch {
+			case test.want == (rekeyed{}) && !bytes.Equal(rotated, test.content):
+				t.Fatalf("rekeyFile changed the file to %q", rotated)
+			case test.want == (rekeyed{}):
+				return
+			case test.mode == encrypt.Line && bytes.Count(rotated, []byte("\r\n")) != bytes.Count(lines, []byte("\n")):
+				t.Fatalf("rekeyFile changed the line endings to %q", rotated)
+			case test.rotated != nil && !bytes.Equal(rotated, test.rotated):
+				t.Fatalf("rekeyFile wrote %q, want %q", rotated, test.rotated)
+			}
+
+			want := plaintext
+			if test.mode == encrypt.Line {
+				want = lines
+			}
+
+			for _, key := range append([]*encrypt.SymmetricKey{newKey}, test.others...) {
+				if decrypted := decryptTestFile(t, key, cfg.Mode, file); !bytes.Equal(decrypted, want) {
+					t.Fatalf("decrypted %q with %s, want %q", decrypted, key, want)
+				}
+			}
+
+			// A second run, as after an interrupted one, finds the file already rotated and leaves it as it is.
+			again, err := rekeyFile(cfg, oldKey, newKey, test.reencrypt, false, file)
+
+			switch {
+			case err != nil:
+				t.Fatalf("rekeyFile on a rotated file: %v", err)
+			case test.want.lines > 0 && again != (rekeyed{rotatedLines: test.want.lines}):
+				t.Fatalf("rekeyFile on a rotated file = %+v, want %d rotated lines", again, test.want.lines)
+			case test.want.lines == 0 && again != (rekeyed{rotated: true}):
+				t.Fatalf("rekeyFile on a rotated file = %+v, want the file rotated", again)
+			}
+
+			if data, _ := os.ReadFile(file); !bytes.Equal(data, rotated) {
+				t.Fatalf("rekeyFile changed a rotated file to %q", data)
+			}
+		})
+	}
+}
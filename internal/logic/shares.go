@@ -0,0 +1,161 @@
+package logic
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/idelchi/gocry/internal/config"
+	"github.com/idelchi/gocry/internal/encrypt"
+	"github.com/idelchi/gocry/internal/shamir"
+	"github.com/idelchi/gogen/pkg/key"
+	"github.com/idelchi/gogen/pkg/printer"
+)
+
+// KeySplit splits the key in keyFile into total shares, any threshold of which rebuild it.
+// The shares are printed to stdout one per line, or written to the files output.1 to output.<total>
+// with permissions for the owner only.
+func KeySplit(keyFile, passphrase string, threshold, total int, output string) error {
+	raw, err := loadRawKey(keyFile, passphrase)
+	if err != nil {
+		return err
+	}
+
+	shares, err := shamir.Split(raw, encrypt.Fingerprint(raw), threshold, total)
+	if err != nil {
+		return fmt.Errorf("%w: %w", config.ErrUsage, err)
+	}
+
+	for _, share := range shares {
+		if output == "" {
+			printer.Stdoutln("%s", share)
+
+			continue
+		}
+
+		file := fmt.Sprintf("%s.%d", output, share.Index)
+		if err := writePrivate(file, share.String()+"\n"); err != nil {
+			return err
+		}
+
+		printer.Stderrln("wrote share %d of %d: %q", share.Index, share.Total, file)
+	}
+
+	printer.Stderrln("split key %s into %d shares, %d needed to combine", encrypt.Fingerprint(raw), total, threshold)
+
+	return nil
+}
+
+// KeyCombine rebuilds a key from the share files, and writes it in hex to output, or stdout if empty.
+func KeyCombine(files []string, output string) error {
+	var shares []shamir.Share
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("reading share file: %w", err)
+		}
+
+		parsed, err := parseShares(string(data))
+		if err != nil {
+			return fmt.Errorf("%q: %w", file, err)
+		}
+
+		shares = append(shares, parsed...)
+	}
+
+	keys, err := combineShares(shares)
+
+	switch {
+	case err != nil:
+		return err
+	case len(keys) == 0:
+		return fmt.Errorf("%w: no shares in %s", shamir.ErrShare, strings.Join(files, ", "))
+	case len(keys) > 1:
+		return fmt.Errorf("%w: shares of %d different keys", shamir.ErrShare, len(keys))
+	}
+
+	encoded := key.Key(keys[0]).AsHex() + "\n"
+
+	if output == "" {
+		_, err := io.WriteString(os.Stdout, encoded)
+
+		return err //nolint: wrapcheck
+	}
+
+	return writePrivate(output, encoded)
+}
+
+// parseShares parses the shares in the content of a share file, one per non-empty line.
+func parseShares(content string) ([]shamir.Share, error) {
+	var shares []shamir.Share
+
+	for _, line := range strings.Split(content, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		share, err := shamir.Parse(line)
+		if err != nil {
+			return nil, err //nolint: wrapcheck
+		}
+
+		shares = append(shares, share)
+	}
+
+	return shares, nil
+}
+
+// combineShares rebuilds the keys from their shares, grouped by the fingerprint they record,
+// and checks each key against its fingerprint.
+func combineShares(shares []shamir.Share) ([][]byte, error) {
+	var fingerprints []string
+
+	groups := make(map[string][]shamir.Share)
+
+	for _, share := range shares {
+		if _, ok := groups[share.Fingerprint]; !ok {
+			fingerprints = append(fingerprints, share.Fingerprint)
+		}
+
+		groups[share.Fingerprint] = append(groups[share.Fingerprint], share)
+	}
+
+	keys := make([][]byte, 0, len(fingerprints))
+
+	for _, fingerprint := range fingerprints {
+		combined, err := shamir.Combine(groups[fingerprint])
+		if err != nil {
+			return nil, fmt.Errorf("combining shares of key %s: %w", fingerprint, err)
+		}
+
+		if encrypt.Fingerprint(combined) != fingerprint {
+			return nil, fmt.Errorf("%w: shares of key %s combine to a different key", shamir.ErrShare, fingerprint)
+		}
+
+		keys = append(keys, combined)
+	}
+
+	return keys, nil
+}
+
+// writePrivate writes content to a new file readable by the owner only.
+func writePrivate(file, content string) error {
+	created, err := createPrivate(file)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(created, content); err != nil {
+		created.Close()
+
+		return fmt.Errorf("writing %q: %w", file, err)
+	}
+
+	if err := created.Close(); err != nil {
+		return fmt.Errorf("closing %q: %w", file, err)
+	}
+
+	return nil
+}
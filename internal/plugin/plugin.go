@@ -0,0 +1,196 @@
+// Package plugin runs key provider plugins, external programs that supply keys from sources
+// gocry does not support natively, such as secret brokers, password managers and key management services.
+//
+// A plugin is an executable named gocry-key-<name> on the PATH, selected with --key-provider name:argument.
+// gocry runs it without arguments, writes a single JSON request to its stdin and reads a single JSON
+// response from its stdout. The stderr of the plugin is passed through, and the plugin can prompt
+// by opening the terminal directly.
+//
+// The request holds the protocol version, the operation and the argument of the provider:
+//
+//	{"version": 1, "operation": "decrypt", "argument": "prod/db"}
+//
+// The response lists the keys, in hex or as Fernet keys, optionally named for use in messages:
+//
+//	{"keys": [{"name": "prod/db@v2", "key": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"}]}
+//
+// or reports why it cannot provide them:
+//
+//	{"error": "access denied"}
+//
+// All keys returned are encrypted for when encrypting, as with several key files,
+// so a plugin typically returns the current key for "encrypt", and all versions still in use for "decrypt".
+//
+// A plugin whose key must not leave it, such as a key in a key management service, replies with
+//
+//	{"wrap": true}
+//
+// instead of keys. gocry then sends it each data key to wrap, base64-encoded:
+//
+//	{"version": 1, "operation": "wrap", "argument": "prod/db", "data_key": "..."}
+//
+// expecting the wrapped key in return, stored as is in the header:
+//
+//	{"wrapped_key": "..."}
+//
+// and sends the wrapped key back to unwrap when decrypting:
+//
+//	{"version": 1, "operation": "unwrap", "argument": "prod/db", "wrapped_key": "..."}
+//
+// expecting the data key in return:
+//
+//	{"data_key": "..."}
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// ErrPlugin indicates a plugin that cannot be run, or that failed to provide keys.
+var ErrPlugin = errors.New("key provider plugin error")
+
+const (
+	// Prefix starts the executable name of every plugin.
+	Prefix = "gocry-key-"
+
+	// Version is the version of the protocol, sent with each request.
+	Version = 1
+)
+
+// Operations requested from plugins.
+const (
+	// Encrypt requests the keys to encrypt for
+	Encrypt = "encrypt"
+
+	// Decrypt requests the keys to decrypt with
+	Decrypt = "decrypt"
+
+	// Wrap requests the data key in the request wrapped
+	Wrap = "wrap"
+
+	// Unwrap requests the data key of the wrapped key in the request
+	Unwrap = "unwrap"
+)
+
+// validName matches plugin names, which must not reach outside of the PATH.
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Request is sent to the plugin on its stdin.
+type Request struct {
+	// Version is the version of the protocol
+	Version int `json:"version"`
+
+	// Operation is the operation requested, "encrypt", "decrypt", "wrap" or "unwrap"
+	Operation string `json:"operation"`
+
+	// Argument is the part of --key-provider after the colon, selecting the keys
+	Argument string `json:"argument"`
+
+	// DataKey is the data key to wrap, for "wrap"
+	DataKey []byte `json:"data_key,omitempty"`
+
+	// WrappedKey is the wrapped key to unwrap, for "unwrap"
+	WrappedKey []byte `json:"wrapped_key,omitempty"`
+}
+
+// Key is a single key provided by the plugin.
+type Key struct {
+	// Name describes the key in messages, if set
+	Name string `json:"name,omitempty"`
+
+	// Key is the key, in hex or as a Fernet key
+	Key string `json:"key"`
+}
+
+// Response is read from the plugin on its stdout.
+type Response struct {
+	// Keys lists the keys provided, for "encrypt" and "decrypt"
+	Keys []Key `json:"keys,omitempty"`
+
+	// Wrap is set instead of keys, for "encrypt" and "decrypt", if the plugin wraps and unwraps data keys itself
+	Wrap bool `json:"wrap,omitempty"`
+
+	// DataKey is the unwrapped data key, for "unwrap"
+	DataKey []byte `json:"data_key,omitempty"`
+
+	// WrappedKey is the wrapped data key, for "wrap"
+	WrappedKey []byte `json:"wrapped_key,omitempty"`
+
+	// Error reports why the plugin cannot provide the keys, if set
+	Error string `json:"error,omitempty"`
+}
+
+// Parse splits a provider given as name:argument into the plugin name and its argument,
+// which may be empty.
+func Parse(provider string) (string, string, error) {
+	name, argument, _ := strings.Cut(provider, ":")
+	if !validName.MatchString(name) {
+		return "", "", fmt.Errorf("%w: invalid plugin name %q in %q, want name:argument", ErrPlugin, name, provider)
+	}
+
+	return name, argument, nil
+}
+
+// Run runs the named plugin with the request and returns its response,
+// checking that it holds what the operation asks for.
+// A plugin exiting with an error still has its error response reported, if it wrote one.
+func Run(name string, request Request) (*Response, error) {
+	executable := Prefix + name
+
+	path, err := exec.LookPath(executable)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrPlugin, err)
+	}
+
+	input, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("%w: encoding request: %w", ErrPlugin, err)
+	}
+
+	cmd := exec.Command(path)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stderr = os.Stderr
+
+	output, runErr := cmd.Output()
+
+	var response Response
+
+	if err := json.Unmarshal(output, &response); err != nil {
+		if runErr != nil {
+			return nil, fmt.Errorf("%w: running %s: %w", ErrPlugin, executable, runErr)
+		}
+
+		return nil, fmt.Errorf("%w: %s: decoding response: %w", ErrPlugin, executable, err)
+	}
+
+	switch {
+	case response.Error != "":
+		return nil, fmt.Errorf("%w: %s: %s", ErrPlugin, executable, response.Error)
+	case runErr != nil:
+		return nil, fmt.Errorf("%w: running %s: %w", ErrPlugin, executable, runErr)
+	}
+
+	switch request.Operation {
+	case Wrap:
+		if len(response.WrappedKey) == 0 {
+			return nil, fmt.Errorf("%w: %s returned no wrapped key", ErrPlugin, executable)
+		}
+	case Unwrap:
+		if len(response.DataKey) == 0 {
+			return nil, fmt.Errorf("%w: %s returned no data key", ErrPlugin, executable)
+		}
+	default:
+		if len(response.Keys) == 0 && !response.Wrap {
+			return nil, fmt.Errorf("%w: %s provided no keys", ErrPlugin, executable)
+		}
+	}
+
+	return &response, nil
+}
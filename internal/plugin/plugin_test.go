@@ -0,0 +1,170 @@
+package plugin_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/idelchi/gocry/internal/plugin"
+	"github.com/idelchi/gocry/internal/plugin/plugintest"
+)
+
+// testKey is a key as returned by the fake plugin.
+const testKey = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+func TestRun(t *testing.T) {
+	request := plugintest.Install(t, "fake", `echo '{"keys": [{"name": "prod@v1", "key": "`+testKey+`"}]}'`)
+
+	response, err := plugin.Run("fake", plugin.Request{Version: plugin.Version, Operation: plugin.Decrypt, Argument: "prod"})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if keys := response.Keys; len(keys) != 1 || keys[0].Name != "prod@v1" || keys[0].Key != testKey {
+		t.Fatalf("Run = %+v, want the key prod@v1", keys)
+	}
+
+	data, err := os.ReadFile(request)
+	if err != nil {
+		t.Fatalf("reading request: %v", err)
+	}
+
+	var received plugin.Request
+	if err := json.Unmarshal(data, &received); err != nil {
+		t.Fatalf("decoding request %q: %v", data, err)
+	}
+
+	if want := (plugin.Request{Version: plugin.Version, Operation: plugin.Decrypt, Argument: "prod"}); !reflect.DeepEqual(received, want) {
+		t.Fatalf("plugin received %+v, want %+v", received, want)
+	}
+}
+
+// TestRunWrap has a fake plugin wrap and unwrap a data key, passed base64-encoded both ways.
+func TestRunWrap(t *testing.T) {
+	tests := []struct {
+		request plugin.Request
+		script  string
+		want    plugin.Response
+	}{
+		{
+			request: plugin.Request{Operation: plugin.Encrypt, Argument: "prod"},
+			script:  `echo '{"wrap": true}'`,
+			want:    plugin.Response{Wrap: true},
+		},
+		{
+			request: plugin.Request{Operation: plugin.Wrap, Argument: "prod", DataKey: []byte("data key")},
+			script:  `echo '{"wrapped_key": "d3JhcHBlZCBrZXk="}'`,
+			want:    plugin.Response{WrappedKey: []byte("wrapped key")},
+		},
+		{
+			request: plugin.Request{Operation: plugin.Unwrap, Argument: "prod", WrappedKey: []byte("wrapped key")},
+			script:  `echo '{"data_key": "ZGF0YSBrZXk="}'`,
+			want:    plugin.Response{DataKey: []byte("data key")},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.request.Operation, func(t *testing.T) {
+			request := plugintest.Install(t, "fake", test.script)
+
+			test.request.Version = plugin.Version
+
+			response, err := plugin.Run("fake", test.request)
+
+			switch {
+			case err != nil:
+				t.Fatalf("Run: %v", err)
+			case !reflect.DeepEqual(*response, test.want):
+				t.Fatalf("Run = %+v, want %+v", *response, test.want)
+			}
+
+			data, err := os.ReadFile(request)
+			if err != nil {
+				t.Fatalf("reading request: %v", err)
+			}
+
+			var received plugin.Request
+			if err := json.Unmarshal(data, &received); err != nil {
+				t.Fatalf("decoding request %q: %v", data, err)
+			}
+
+			if !reflect.DeepEqual(received, test.request) {
+				t.Fatalf("plugin received %+v, want %+v", received, test.request)
+			}
+		})
+	}
+}
+
+func TestRunFailures(t *testing.T) {
+	tests := []struct {
+		name      string
+		operation string
+		script    string
+		want      string
+	}{
+		{name: "error response", script: `echo '{"error": "access denied"}'; exit 1`, want: "access denied"},
+		{name: "non-zero exit", script: `exit 3`, want: "exit status 3"},
+		{name: "malformed response", script: `echo '{"keys": ['`, want: "decoding response"},
+		{name: "no keys", script: `echo '{"keys": []}'`, want: "provided no keys"},
+		{name: "no wrapped key", operation: plugin.Wrap, script: `echo '{"wrap": true}'`, want: "no wrapped key"},
+		{name: "no data key", operation: plugin.Unwrap, script: `echo '{"keys": []}'`, want: "no data key"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plugintest.Install(t, "fake", test.script)
+
+			operation := test.operation
+			if operation == "" {
+				operation = plugin.Encrypt
+			}
+
+			_, err := plugin.Run("fake", plugin.Request{Version: plugin.Version, Operation: operation})
+
+			switch {
+			case !errors.Is(err, plugin.ErrPlugin):
+				t.Fatalf("Run error = %v, want %v", err, plugin.ErrPlugin)
+			case !strings.Contains(err.Error(), test.want):
+				t.Fatalf("Run error = %v, want it to mention %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		provider string
+		name     string
+		argument string
+		valid    bool
+	}{
+		{provider: "fake:prod/db", name: "fake", argument: "prod/db", valid: true},
+		{provider: "fake", name: "fake", valid: true},
+		{provider: "fake:a:b", name: "fake", argument: "a:b", valid: true},
+		{provider: ":prod"},
+		{provider: "../fake:prod"},
+		{provider: "sub/fake:prod"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.provider, func(t *testing.T) {
+			t.Parallel()
+
+			name, argument, err := plugin.Parse(test.provider)
+
+			switch {
+			case !test.valid && !errors.Is(err, plugin.ErrPlugin):
+				t.Fatalf("Parse error = %v, want %v", err, plugin.ErrPlugin)
+			case test.valid && err != nil:
+				t.Fatalf("Parse: %v", err)
+			case name != test.name || argument != test.argument:
+				t.Fatalf("Parse = %q, %q, want %q, %q", name, argument, test.name, test.argument)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+// Package plugintest installs fake key provider plugins for tests.
+package plugintest
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/idelchi/gocry/internal/plugin"
+)
+
+// Install writes the fake plugin gocry-key-<name> running the shell script, puts it first on the PATH,
+// and returns the file the plugin saves the request it receives to.
+// The test is skipped where plugins cannot be shell scripts.
+func Install(t testing.TB, name, script string) string {
+	t.Helper()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("plugins are shell scripts")
+	}
+
+	dir := t.TempDir()
+	request := filepath.Join(dir, "request.json")
+	content := "#!/bin/sh\ncat > '" + request + "'\n" + script + "\n"
+
+	if err := os.WriteFile(filepath.Join(dir, plugin.Prefix+name), []byte(content), 0o700); err != nil { //nolint: gosec
+		t.Fatalf("writing plugin: %v", err)
+	}
+
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	return request
+}
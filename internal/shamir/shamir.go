@@ -0,0 +1,271 @@
+// Package shamir splits secrets into shares with Shamir's secret sharing over GF(2^8),
+// so that any threshold of the shares rebuilds the secret while fewer reveal nothing about it.
+//
+// Shares are written as self-describing text lines:
+//
+//	gocry-share:v1:<fingerprint>:<threshold>of<total>:<index>:<hex share>:<checksum>
+//
+// where the fingerprint identifies the secret the share belongs to,
+// and the checksum is the first 4 bytes of the SHA-256 of the rest of the line, in hex.
+package shamir
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ErrShare indicates a malformed share, or a set of shares that cannot be combined.
+var ErrShare = errors.New("invalid share")
+
+const (
+	// prefix starts every share.
+	prefix = "gocry-share:v1:"
+
+	// fields is the number of colon-separated fields of a share, including the two of the prefix.
+	fields = 7
+
+	// checksumSize is the size of the share checksum.
+	checksumSize = 4
+
+	// maxShares is the maximum number of shares, as the share index is a non-zero byte.
+	maxShares = 255
+
+	// reduction is the AES polynomial x^8 + x^4 + x^3 + x + 1, without its x^8 term.
+	reduction = 0x1b
+)
+
+// Share is a single share of a secret.
+type Share struct {
+	// Fingerprint identifies the secret the share belongs to
+	Fingerprint string
+
+	// Threshold is the number of shares needed to rebuild the secret
+	Threshold int
+
+	// Total is the number of shares the secret was split into
+	Total int
+
+	// Index is the x-coordinate of the share, from 1 to Total
+	Index byte
+
+	// Value holds the share of each byte of the secret
+	Value []byte
+}
+
+// Split splits the secret into total shares, any threshold of which rebuild it.
+// The fingerprint is recorded in each share to tell the shares of different secrets apart.
+func Split(secret []byte, fingerprint string, threshold, total int) ([]Share, error) {
+	switch {
+	case threshold < 2:
+		return nil, fmt.Errorf("%w: threshold must be at least 2, got %d", ErrShare, threshold)
+	case total < threshold:
+		return nil, fmt.Errorf("%w: shares (%d) must be at least the threshold (%d)", ErrShare, total, threshold)
+	case total > maxShares:
+		return nil, fmt.Errorf("%w: at most %d shares, got %d", ErrShare, maxShares, total)
+	case len(secret) == 0:
+		return nil, fmt.Errorf("%w: empty secret", ErrShare)
+	case strings.Contains(fingerprint, ":"):
+		return nil, fmt.Errorf("%w: fingerprint %q contains a colon", ErrShare, fingerprint)
+	}
+
+	shares := make([]Share, total)
+	for i := range shares {
+		shares[i] = Share{
+			Fingerprint: fingerprint,
+			Threshold:   threshold,
+			Total:       total,
+			Index:       byte(i + 1),
+			Value:       make([]byte, len(secret)),
+		}
+	}
+
+	// Each byte of the secret is the constant term of its own random polynomial of degree threshold-1.
+	coefficients := make([]byte, threshold)
+
+	for position, value := range secret {
+		coefficients[0] = value
+		if _, err := io.ReadFull(rand.Reader, coefficients[1:]); err != nil {
+			return nil, fmt.Errorf("generating coefficients: %w", err)
+		}
+
+		for i := range shares {
+			shares[i].Value[position] = evaluate(coefficients, shares[i].Index)
+		}
+	}
+
+	return shares, nil
+}
+
+// Combine rebuilds the secret from at least threshold shares of it.
+func Combine(shares []Share) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, fmt.Errorf("%w: no shares", ErrShare)
+	}
+
+	first := shares[0]
+	seen := make(map[byte]bool)
+
+	for _, share := range shares {
+		if err := share.validate(); err != nil {
+			return nil, err
+		}
+
+		switch {
+		case share.Fingerprint != first.Fingerprint:
+			return nil, fmt.Errorf("%w: shares of different keys %s and %s", ErrShare, first.Fingerprint, share.Fingerprint)
+		case share.Threshold != first.Threshold || share.Total != first.Total || len(share.Value) != len(first.Value):
+			return nil, fmt.Errorf("%w: shares from different splits", ErrShare)
+		case seen[share.Index]:
+			return nil, fmt.Errorf("%w: share %d given twice", ErrShare, share.Index)
+		}
+
+		seen[share.Index] = true
+	}
+
+	if len(shares) < first.Threshold {
+		return nil, fmt.Errorf("%w: %d of %d shares needed, got %d", ErrShare, first.Threshold, first.Total, len(shares))
+	}
+
+	shares = shares[:first.Threshold]
+	secret := make([]byte, len(first.Value))
+
+	// Lagrange interpolation at x = 0.
+	for i, share := range shares {
+		basis := byte(1)
+
+		for j, other := range shares {
+			if i != j {
+				basis = mul(basis, div(other.Index, other.Index^share.Index))
+			}
+		}
+
+		for position := range secret {
+			secret[position] ^= mul(share.Value[position], basis)
+		}
+	}
+
+	return secret, nil
+}
+
+// String encodes the share as a text line, without a trailing newline.
+func (s Share) String() string {
+	body := fmt.Sprintf("%s%s:%dof%d:%d:%s", prefix, s.Fingerprint, s.Threshold, s.Total, s.Index, hex.EncodeToString(s.Value))
+
+	return body + ":" + checksum(body)
+}
+
+// IsShare reports whether data looks like a share, as opposed to a key.
+func IsShare(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte(prefix))
+}
+
+// Parse decodes a share from its text line, verifying its checksum.
+func Parse(text string) (Share, error) {
+	text = strings.TrimSpace(text)
+
+	if !strings.HasPrefix(text, prefix) {
+		return Share{}, fmt.Errorf("%w: missing %q prefix", ErrShare, prefix)
+	}
+
+	parts := strings.Split(text, ":")
+	if len(parts) != fields {
+		return Share{}, fmt.Errorf("%w: want %d fields, got %d", ErrShare, fields, len(parts))
+	}
+
+	body := text[:strings.LastIndex(text, ":")]
+	if checksum(body) != parts[6] {
+		return Share{}, fmt.Errorf("%w: checksum mismatch, the share is mistyped or damaged", ErrShare)
+	}
+
+	share := Share{Fingerprint: parts[2]}
+
+	threshold, total, ok := strings.Cut(parts[3], "of")
+	if !ok {
+		return Share{}, fmt.Errorf("%w: malformed threshold %q", ErrShare, parts[3])
+	}
+
+	var err error
+
+	if share.Threshold, err = strconv.Atoi(threshold); err != nil {
+		return Share{}, fmt.Errorf("%w: malformed threshold %q", ErrShare, parts[3])
+	}
+
+	if share.Total, err = strconv.Atoi(total); err != nil {
+		return Share{}, fmt.Errorf("%w: malformed threshold %q", ErrShare, parts[3])
+	}
+
+	index, err := strconv.ParseUint(parts[4], 10, 8)
+	if err != nil {
+		return Share{}, fmt.Errorf("%w: malformed index %q", ErrShare, parts[4])
+	}
+
+	share.Index = byte(index)
+
+	if share.Value, err = hex.DecodeString(parts[5]); err != nil {
+		return Share{}, fmt.Errorf("%w: malformed value: %w", ErrShare, err)
+	}
+
+	return share, share.validate()
+}
+
+// validate checks that 2 <= threshold <= total <= 255 and 1 <= index <= total, as written by Split.
+func (s Share) validate() error {
+	switch {
+	case s.Threshold < 2 || s.Threshold > s.Total || s.Total > maxShares:
+		return fmt.Errorf("%w: invalid threshold %dof%d", ErrShare, s.Threshold, s.Total)
+	case s.Index == 0 || int(s.Index) > s.Total:
+		return fmt.Errorf("%w: index %d out of range 1 to %d", ErrShare, s.Index, s.Total)
+	}
+
+	return nil
+}
+
+// checksum returns the checksum of the share text.
+func checksum(body string) string {
+	sum := sha256.Sum256([]byte(body))
+
+	return hex.EncodeToString(sum[:checksumSize])
+}
+
+// evaluate evaluates the polynomial with the given coefficients, lowest degree first, at x.
+func evaluate(coefficients []byte, x byte) byte {
+	var result byte
+
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		result = mul(result, x) ^ coefficients[i]
+	}
+
+	return result
+}
+
+// mul multiplies in GF(2^8) with the AES polynomial x^8 + x^4 + x^3 + x + 1,
+// without data-dependent branches or table lookups.
+func mul(a, b byte) byte {
+	var product byte
+
+	for range 8 {
+		product ^= -(b & 1) & a
+		a = (a << 1) ^ (-(a >> 7) & reduction)
+		b >>= 1
+	}
+
+	return product
+}
+
+// div divides in GF(2^8), with b non-zero, as a times the inverse of b, which is b^254.
+func div(a, b byte) byte {
+	inverse := b
+
+	for range 6 {
+		inverse = mul(mul(inverse, inverse), b)
+	}
+
+	return mul(a, mul(inverse, inverse))
+}
@@ -0,0 +1,102 @@
+package shamir_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/idelchi/gocry/internal/shamir"
+)
+
+// TestSplitCombine checks that every subset of at least threshold shares rebuilds the secret,
+// through the text encoding of the shares, and that fewer shares do not.
+func TestSplitCombine(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("0123456789abcdef0123456789abcdef")
+
+	for _, split := range []struct{ threshold, total int }{{2, 2}, {2, 3}, {3, 5}, {5, 5}} {
+		t.Run(fmt.Sprintf("%dof%d", split.threshold, split.total), func(t *testing.T) {
+			t.Parallel()
+
+			shares, err := shamir.Split(secret, "fingerprint", split.threshold, split.total)
+			if err != nil {
+				t.Fatalf("Split: %v", err)
+			}
+
+			for subset := range 1 << split.total {
+				var selected []shamir.Share
+
+				for i, share := range shares {
+					if subset&(1<<i) == 0 {
+						continue
+					}
+
+					parsed, err := shamir.Parse(share.String())
+					if err != nil {
+						t.Fatalf("Parse(%q): %v", share, err)
+					}
+
+					selected = append(selected, parsed)
+				}
+
+				combined, err := shamir.Combine(selected)
+
+				switch {
+				case len(selected) < split.threshold && err == nil:
+					t.Fatalf("Combine of %d shares succeeded, want at least %d", len(selected), split.threshold)
+				case len(selected) < split.threshold:
+					continue
+				case err != nil:
+					t.Fatalf("Combine of shares %b: %v", subset, err)
+				case !bytes.Equal(combined, secret):
+					t.Fatalf("Combine of shares %b = %x, want %x", subset, combined, secret)
+				}
+			}
+		})
+	}
+}
+
+// TestParseBounds checks that shares with an impossible threshold, total or index are rejected.
+func TestParseBounds(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		split string
+		index string
+		valid bool
+	}{
+		{split: "2of3", index: "1", valid: true},
+		{split: "3of3", index: "3", valid: true},
+		{split: "2of255", index: "255", valid: true},
+		{split: "-1of3", index: "1"},
+		{split: "0of3", index: "1"},
+		{split: "1of3", index: "1"},
+		{split: "4of3", index: "1"},
+		{split: "2of256", index: "1"},
+		{split: "2of3", index: "0"},
+		{split: "2of3", index: "4"},
+		{split: "2of3", index: "256"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.split+":"+test.index, func(t *testing.T) {
+			t.Parallel()
+
+			body := fmt.Sprintf("gocry-share:v1:fingerprint:%s:%s:00ff", test.split, test.index)
+			sum := sha256.Sum256([]byte(body))
+
+			_, err := shamir.Parse(body + ":" + hex.EncodeToString(sum[:4]))
+
+			switch {
+			case test.valid && err != nil:
+				t.Fatalf("Parse: %v", err)
+			case !test.valid && !errors.Is(err, shamir.ErrShare):
+				t.Fatalf("Parse error = %v, want %v", err, shamir.ErrShare)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+// Package terminal reads secrets interactively from the user's terminal.
+package terminal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// ErrNoTerminal indicates that there is no terminal to prompt on.
+var ErrNoTerminal = errors.New("no terminal available")
+
+// ReadPassword writes the prompt to the terminal and reads a line from it without echoing.
+// The controlling terminal is opened directly, so that prompting works while
+// stdin and stdout carry data, as is the case in git filters.
+func ReadPassword(prompt string) ([]byte, error) {
+	var (
+		input            = os.Stdin
+		output io.Writer = os.Stderr
+	)
+
+	if tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0); err == nil {
+		defer tty.Close()
+
+		input, output = tty, tty
+	}
+
+	if !term.IsTerminal(int(input.Fd())) {
+		return nil, ErrNoTerminal
+	}
+
+	fmt.Fprint(output, prompt)
+
+	password, err := term.ReadPassword(int(input.Fd()))
+
+	fmt.Fprintln(output)
+
+	if err != nil {
+		return nil, fmt.Errorf("reading password: %w", err)
+	}
+
+	return password, nil
+}